@@ -0,0 +1,318 @@
+package cache
+
+import (
+	"container/list"
+	"io"
+	"sync"
+)
+
+// arcList identify which list an arc entry is in
+type arcList int8
+
+const (
+	_T1 arcList = iota // recently used once
+	_T2                // recently used at least twice
+	_B1                // ghost of entries eliminated from T1
+	_B2                // ghost of entries eliminated from T2
+)
+
+// arcCacheEntry is a item of arc cache, entries in ghost lists have no value
+type arcCacheEntry struct {
+	key   string
+	val   interface{}
+	where arcList
+}
+
+// arcCache is a cacher use adaptive replacement cache algorithm, it keep
+// recency list T1 and frequency list T2 with their ghost lists B1, B2, and
+// adapt T1's target size p by ghost hits, so an one-time scan only flush T1
+// but not the frequently used entries in T2
+type arcCache struct {
+	instrument
+	tagIndex
+	periodicSnapshot
+	lists   [4]*list.List
+	index   map[string]*list.Element
+	p       int // target size of T1
+	maxSize int
+	lock    *sync.Mutex
+}
+
+// Init init arc cacher
+func (ac *arcCache) Init(config string) error {
+	return ac.InitVals(config, nil)
+}
+
+// InitVals init arc cacher with initial values
+func (ac *arcCache) InitVals(config string, values map[string]interface{}) (err error) {
+	if ac.maxSize, err = parseMaxSize(config); err == nil {
+		fixSize(values, ac.maxSize)
+		for i := range ac.lists {
+			ac.lists[i] = list.New()
+		}
+		ac.index = make(map[string]*list.Element, ac.maxSize*2)
+		ac.lock = new(sync.Mutex)
+		for k, v := range values {
+			ac.push(&arcCacheEntry{key: k, val: v}, _T1)
+		}
+	}
+	return
+}
+
+// len return length of list
+func (ac *arcCache) len(l arcList) int {
+	return ac.lists[l].Len()
+}
+
+// size return count of cached entries, ghosts are not counted
+func (ac *arcCache) size() int {
+	return ac.len(_T1) + ac.len(_T2)
+}
+
+// Size return current cache count
+func (ac *arcCache) Size() int {
+	ac.lock.Lock()
+	size := ac.size()
+	ac.lock.Unlock()
+	return size
+}
+
+// Cap return cache capacity
+func (ac *arcCache) Cap() int {
+	return ac.maxSize
+}
+
+// lookup return element of a cached key, ghost is not returned
+func (ac *arcCache) lookup(key string) (*list.Element, bool) {
+	elem, has := ac.index[key]
+	if has {
+		if where := elem.Value.(*arcCacheEntry).where; where != _T1 && where != _T2 {
+			return nil, false
+		}
+	}
+	return elem, has
+}
+
+// Get return value of the key, if not exist, nil returned
+func (ac *arcCache) Get(key string) (val interface{}) {
+	ac.lock.Lock()
+	elem, has := ac.lookup(key)
+	if has {
+		entry := ac.move(elem, _T2)
+		val = entry.val
+	}
+	ac.lock.Unlock()
+	ac.recordGet(has)
+	return
+}
+
+// IsExist check whether key exist, it don't affect the lists
+func (ac *arcCache) IsExist(key string) bool {
+	ac.lock.Lock()
+	_, has := ac.lookup(key)
+	ac.lock.Unlock()
+	return has
+}
+
+// Remove remove key and it's value from cache, ghost is not affected
+func (ac *arcCache) Remove(key string) {
+	ac.lock.Lock()
+	elem, has := ac.lookup(key)
+	if has {
+		ac.unlink(elem)
+		ac.untag(key)
+	}
+	ac.lock.Unlock()
+	if has {
+		ac.recordRemove()
+	}
+}
+
+// Set add an key-value to cache, if key already exist in cache, update it's value
+func (ac *arcCache) Set(key string, val interface{}) {
+	ac.set(key, val, true, nil)
+}
+
+// Update only update existed key-value, returned value show whether it's successed
+func (ac *arcCache) Update(key string, val interface{}) bool {
+	return ac.set(key, val, false, nil)
+}
+
+// set do actually update cache, if forceSet, tags of key are replaced by tags
+func (ac *arcCache) set(key string, val interface{}, forceSet bool, tags []string) (ret bool) {
+	var evicted *arcCacheEntry
+	ac.lock.Lock()
+	elem, has := ac.index[key]
+	var where arcList
+	if has {
+		where = elem.Value.(*arcCacheEntry).where
+	}
+	switch {
+	case has && (where == _T1 || where == _T2):
+		ac.move(elem, _T2).val = val
+		ret = true
+	case !forceSet:
+	case has && where == _B1:
+		ac.p = minInt(ac.maxSize, ac.p+maxInt(ac.len(_B2)/ac.len(_B1), 1))
+		evicted = ac.replace(false)
+		ac.move(elem, _T2).val = val
+		ret = true
+	case has && where == _B2:
+		ac.p = maxInt(0, ac.p-maxInt(ac.len(_B1)/ac.len(_B2), 1))
+		evicted = ac.replace(true)
+		ac.move(elem, _T2).val = val
+		ret = true
+	default:
+		l1 := ac.len(_T1) + ac.len(_B1)
+		total := l1 + ac.len(_T2) + ac.len(_B2)
+		if l1 >= ac.maxSize {
+			if ac.len(_T1) < ac.maxSize {
+				ac.unlink(ac.lists[_B1].Back())
+				evicted = ac.replace(false)
+			} else {
+				evicted = ac.unlink(ac.lists[_T1].Back())
+			}
+		} else if total >= ac.maxSize {
+			if total >= 2*ac.maxSize {
+				ac.unlink(ac.lists[_B2].Back())
+			}
+			evicted = ac.replace(false)
+		}
+		ac.push(&arcCacheEntry{key: key, val: val}, _T1)
+		ret = true
+	}
+	if evicted != nil {
+		ac.untag(evicted.key)
+	}
+	if ret && forceSet {
+		ac.retag(key, tags)
+	}
+	ac.lock.Unlock()
+	if ret {
+		ac.recordSet()
+	}
+	if evicted != nil {
+		ac.evict(evicted.key, evicted.val)
+	}
+	return
+}
+
+// replace move lru entry of T1 or T2 to it's ghost list if cache is full,
+// the eliminated entry is returned
+func (ac *arcCache) replace(inB2 bool) *arcCacheEntry {
+	if ac.size() < ac.maxSize {
+		return nil
+	}
+	from, to := _T2, _B2
+	if t1 := ac.len(_T1); t1 > 0 && (t1 > ac.p || (inB2 && t1 == ac.p)) {
+		from, to = _T1, _B1
+	} else if ac.len(_T2) == 0 {
+		from, to = _T1, _B1
+	}
+	entry := ac.move(ac.lists[from].Back(), to)
+	evicted := &arcCacheEntry{key: entry.key, val: entry.val}
+	entry.val = nil
+	return evicted
+}
+
+// push add entry to front of list
+func (ac *arcCache) push(entry *arcCacheEntry, l arcList) {
+	entry.where = l
+	ac.index[entry.key] = ac.lists[l].PushFront(entry)
+}
+
+// unlink remove element from it's list and index
+func (ac *arcCache) unlink(elem *list.Element) *arcCacheEntry {
+	entry := elem.Value.(*arcCacheEntry)
+	ac.lists[entry.where].Remove(elem)
+	delete(ac.index, entry.key)
+	return entry
+}
+
+// move move element to front of given list
+func (ac *arcCache) move(elem *list.Element, l arcList) *arcCacheEntry {
+	entry := elem.Value.(*arcCacheEntry)
+	if entry.where == l {
+		ac.lists[l].MoveToFront(elem)
+	} else {
+		ac.unlink(elem)
+		ac.push(entry, l)
+	}
+	return entry
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Dump write all cached entries to writer, entries of T1 is first, then T2,
+// both from least recently used to most recently used, ghosts are not dumped
+func (ac *arcCache) Dump(w io.Writer) error {
+	ac.lock.Lock()
+	entries := make([]snapshotEntry, 0, ac.size())
+	for _, l := range []arcList{_T1, _T2} {
+		for elem := ac.lists[l].Back(); elem != nil; elem = elem.Prev() {
+			entry := elem.Value.(*arcCacheEntry)
+			freq := 1
+			if l == _T2 {
+				freq = 2
+			}
+			entries = append(entries, snapshotEntry{Key: entry.key, Val: entry.val, Freq: freq})
+		}
+	}
+	ac.lock.Unlock()
+	return dumpEntries(w, entries)
+}
+
+// Load read entries from reader and add them to cache, frequently used
+// entries are restored to T2
+func (ac *arcCache) Load(r io.Reader) error {
+	return loadEntries(r, func(e *snapshotEntry) {
+		ac.Set(e.Key, e.Val)
+		if e.Freq > 1 {
+			ac.lock.Lock()
+			if elem, has := ac.lookup(e.Key); has {
+				ac.move(elem, _T2)
+			}
+			ac.lock.Unlock()
+		}
+	})
+}
+
+// SetWithTags add an key-value to cache, and bind it to tags
+func (ac *arcCache) SetWithTags(key string, val interface{}, tags ...string) {
+	ac.set(key, val, true, tags)
+}
+
+// InvalidateTag remove all keys bind to tag
+func (ac *arcCache) InvalidateTag(tag string) {
+	removeKeys(ac, ac.tagged(tag))
+}
+
+// RemovePrefix remove all keys start with prefix
+func (ac *arcCache) RemovePrefix(prefix string) {
+	removePrefix(ac, ac.keys(), prefix)
+}
+
+// keys return all cached keys, ghosts are not included
+func (ac *arcCache) keys() []string {
+	ac.lock.Lock()
+	keys := make([]string, 0, ac.size())
+	for _, l := range []arcList{_T1, _T2} {
+		for elem := ac.lists[l].Front(); elem != nil; elem = elem.Next() {
+			keys = append(keys, elem.Value.(*arcCacheEntry).key)
+		}
+	}
+	ac.lock.Unlock()
+	return keys
+}
@@ -6,6 +6,7 @@
 package cache
 
 import (
+	"github.com/cosiner/gohper/config"
 	. "github.com/cosiner/gohper/lib/errors"
 	"github.com/cosiner/gohper/lib/types"
 )
@@ -21,6 +22,16 @@ func (ct CacherType) String() (str string) {
 		str = "LRU-eliminate"
 	case REDIS:
 		str = "Redis"
+	case EXPIRE:
+		str = "Expire"
+	case SHARDED_LRU:
+		str = "Sharded-LRU-eliminate"
+	case LFU:
+		str = "LFU-eliminate"
+	case ARC:
+		str = "ARC-eliminate"
+	case TIERED:
+		str = "Tiered"
 	}
 	return
 }
@@ -32,6 +43,16 @@ const (
 	LRU
 	// REDIS is redis cacher
 	REDIS
+	// EXPIRE is a cacher that entries will be expired after their time to live
+	EXPIRE
+	// SHARDED_LRU is lru eliminate algorithm with keys hashed to independent segments
+	SHARDED_LRU
+	// LFU is lfu eliminate algorithm
+	LFU
+	// ARC is adaptive replacement cache algorithm, it's scan resistant
+	ARC
+	// TIERED is two-level cacher of local lru cache and redis
+	TIERED
 
 	ErrUnsupportedType = Err("Not supported cache type")
 	ErrWrongFormat     = Err("Wrong format of config")
@@ -57,10 +78,27 @@ type Cache interface {
 	Size() int
 	// Cap return cache capacity
 	Cap() int
+	// Stats return statistics of cache
+	Stats() Stats
+}
+
+// Destroyer is implemented by cachers that run background goroutines, such as
+// expire and tiered cache, Destroy stop them, it's safe to call it more than once
+type Destroyer interface {
+	Destroy()
 }
 
 // New return a actual cache container
-// for cacher with elimination:Random and LRU, maxsize is the max capcity of cache
+// for cacher with elimination:Random, LRU, LFU and ARC, maxsize is the max capcity of cache
+// for random and lru cache, maxbytes=256M bound cache by memory cost of entries
+// instead of count, entries are measured by DefaultSizer, see SizeBounded
+// for sharded lru cache, config is like maxsize=100000&shards=64
+// for expire cache, config is like expire=30s&interval=1m
+// for tiered cache, config is like l1.maxsize=1000&l2.addr=127.0.0.1:6379
+// for in-memory cachers, snapshot=path&snapshot.interval=5m make the cache
+// loaded from the file and dumped to it periodically, see StartSnapshot,
+// StopSnapshot of Snapshotter stop it and do the final dump
+// for expire and tiered cache, Destroy of Destroyer must be called after use
 // for ordinary cache, no config need, no error returned
 func New(typ CacherType, config string) (cache Cache, err error) {
 	switch typ {
@@ -70,10 +108,23 @@ func New(typ CacherType, config string) (cache Cache, err error) {
 		cache = new(lruCache)
 	case REDIS:
 		cache = new(RedisCache)
+	case EXPIRE:
+		cache = new(expireCache)
+	case SHARDED_LRU:
+		cache = new(shardedLRUCache)
+	case LFU:
+		cache = new(lfuCache)
+	case ARC:
+		cache = new(arcCache)
+	case TIERED:
+		cache = new(tieredCache)
 	default:
 		return nil, ErrUnsupportedType
 	}
-	return cache, cache.Init(config)
+	if err = cache.Init(config); err == nil {
+		err = startConfigSnapshot(cache, config)
+	}
+	return cache, err
 }
 
 // fixSize fix values's size by random remove the rest elemtents
@@ -86,11 +137,21 @@ func fixSize(values map[string]interface{}, size int) {
 }
 
 // parseMaxSize parse maxsize  from config string
-func parseMaxSize(config string) (maxsize int, err error) {
-	pair := types.ParsePair(config, "=")
-	if pair.NoKey() || pair.NoValue() || pair.Key != "maxsize" {
-		err = ErrWrongFormat
-	} else if maxsize, err = pair.IntValue(); err != nil || maxsize <= 0 {
+func parseMaxSize(conf string) (int, error) {
+	return parsePositiveInt(conf, "maxsize", 0)
+}
+
+// parsePositiveInt parse an positive integer bind to key from config string,
+// if key not exist and default value is positive, use default value
+func parsePositiveInt(conf, key string, def int) (n int, err error) {
+	c := config.NewConfig(config.LINE)
+	c.ParseString(conf)
+	if s, has := c.Val(key); !has {
+		n = def
+	} else if n, err = types.Str2Int(s); err != nil {
+		n = 0
+	}
+	if n <= 0 {
 		err = ErrWrongFormat
 	}
 	return
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"testing"
+	"time"
 
 	"github.com/cosiner/gohper/lib/test"
 )
@@ -36,6 +37,86 @@ func TestLRUCache(t *testing.T) {
 	tt.Eq(nil, cache.Get("c"))
 }
 
+func TestExpireCache(t *testing.T) {
+	tt := test.Wrap(t)
+	c, err := New(EXPIRE, "expire=50ms&interval=10ms")
+	tt.Nil(err)
+	cache := c.(ExpireCache)
+	cache.Set("a", "a")
+	cache.SetWithExpire("b", "b", 0)
+	cache.SetWithExpire("c", "c", time.Hour)
+	tt.Eq("a", cache.Get("a").(string))
+	tt.True(cache.Update("a", "aa"))
+	tt.Eq(-1, cache.Cap())
+	tt.Eq(3, cache.Size())
+
+	time.Sleep(100 * time.Millisecond)
+	tt.Eq(2, cache.Size()) // reclaimed by janitor
+	tt.Eq(nil, cache.Get("a"))
+	tt.False(cache.Update("a", "a"))
+	tt.Eq("b", cache.Get("b").(string))
+	tt.True(cache.IsExist("c"))
+
+	c.(ExpireCache).Destroy()
+
+	c, _ = New(EXPIRE, "interval=1h")
+	cache = c.(ExpireCache)
+	cache.Set("a", "a")
+	cache.SetWithExpire("b", "b", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	tt.False(cache.IsExist("b"))
+	tt.Eq(2, cache.Size())
+	tt.Eq(nil, cache.Get("b")) // reclaimed lazily
+	tt.Eq(1, cache.Size())
+	cache.Destroy()
+	cache.Destroy() // destroy again is allowed
+
+	_, err = New(EXPIRE, "expire=abc")
+	tt.Eq(ErrWrongFormat, err)
+}
+
+func TestCacheStats(t *testing.T) {
+	tt := test.Wrap(t)
+	for _, typ := range []CacherType{RANDOM, LRU} {
+		evicted := make(map[string]interface{})
+		cache, _ := New(typ, "maxsize=2")
+		cache.(EvictNotifier).SetEvictHook(EvictHookFunc(func(key string, val interface{}) {
+			evicted[key] = val
+		}))
+		cache.Set("a", 1)
+		cache.Set("b", 2)
+		cache.Set("b", 3)
+		cache.Get("b")
+		cache.Get("c")
+		cache.Set("c", 4)
+		cache.Remove("c")
+		cache.Remove("c")
+		tt.False(cache.Update("d", 5))
+
+		s := cache.Stats()
+		tt.Eq(uint64(1), s.Hits)
+		tt.Eq(uint64(1), s.Misses)
+		tt.Eq(uint64(4), s.Sets)
+		tt.Eq(uint64(1), s.Removals)
+		tt.Eq(uint64(1), s.Evictions)
+		tt.Eq(0.5, s.HitRate())
+		tt.Eq(1, len(evicted))
+	}
+
+	evicted := make(chan string, 1)
+	c, _ := New(EXPIRE, "interval=1h")
+	c.(EvictNotifier).SetEvictHook(EvictHookFunc(func(key string, val interface{}) {
+		evicted <- key
+	}))
+	c.(ExpireCache).SetWithExpire("a", 1, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	tt.Eq(nil, c.Get("a"))
+	tt.Eq("a", <-evicted)
+	tt.Eq(uint64(1), c.Stats().Evictions)
+	tt.Eq(uint64(1), c.Stats().Misses)
+	c.(ExpireCache).Destroy()
+}
+
 func TestRedisCache(t *testing.T) {
 	tt := test.Wrap(t)
 	cache, err := New(REDIS, "addr=127.0.0.1:6379")
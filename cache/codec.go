@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+
+	"github.com/cosiner/gohper/lib/encoding"
+	. "github.com/cosiner/gohper/lib/errors"
+)
+
+const (
+	ErrNoCodec     = Err("No codec for cache")
+	ErrNonPointer  = Err("Decode destination must be a non-nil pointer")
+	ErrUnknowCodec = Err("Unknown codec")
+)
+
+// Codec encode values before store them to external cache, and decode them back
+type Codec interface {
+	// Encode encode value to bytes
+	Encode(val interface{}) ([]byte, error)
+	// Decode decode bytes to value
+	Decode(data []byte) (interface{}, error)
+	// DecodeInto decode bytes to value that ptr point to
+	DecodeInto(data []byte, ptr interface{}) error
+}
+
+var (
+	// GOBCodec encode values use gob, the value decoded has same type with
+	// the encoded one, but non-builtin types must be registered by RegisterType
+	GOBCodec Codec = gobCodec{}
+	// JSONCodec encode values use json, values decoded by Decode has json's
+	// generic types, use DecodeInto to decode to a typed value
+	JSONCodec Codec = jsonCodec{}
+)
+
+// RegisterType register a non-builtin type to GOBCodec, it's required for
+// decoding value to the type it's encoded from
+func RegisterType(val interface{}) {
+	gob.Register(val)
+}
+
+// CodecByName return codec of given name, gob or json
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "gob":
+		return GOBCodec, nil
+	case "json":
+		return JSONCodec, nil
+	}
+	return nil, ErrUnknowCodec
+}
+
+// gobValue wrap value to be gob encoded so it's type is also encoded
+type gobValue struct {
+	V interface{}
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Encode(val interface{}) ([]byte, error) {
+	return encoding.GOBEncode(&gobValue{val})
+}
+
+func (gobCodec) Decode(data []byte) (interface{}, error) {
+	var v gobValue
+	err := encoding.GOBDecode(data, &v)
+	return v.V, err
+}
+
+func (c gobCodec) DecodeInto(data []byte, ptr interface{}) error {
+	val, err := c.Decode(data)
+	if err == nil {
+		err = assign(ptr, val)
+	}
+	return err
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(val interface{}) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+func (jsonCodec) Decode(data []byte) (val interface{}, err error) {
+	err = json.Unmarshal(data, &val)
+	return
+}
+
+func (jsonCodec) DecodeInto(data []byte, ptr interface{}) error {
+	return json.Unmarshal(data, ptr)
+}
+
+// assign set the value ptr point to as val
+func assign(ptr, val interface{}) error {
+	p := reflect.ValueOf(ptr)
+	if p.Kind() != reflect.Ptr || p.IsNil() {
+		return ErrNonPointer
+	}
+	dst := p.Elem()
+	if val == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	v := reflect.ValueOf(val)
+	if !v.Type().AssignableTo(dst.Type()) {
+		return Errorf("Can't assign %s to %s", v.Type(), dst.Type())
+	}
+	dst.Set(v)
+	return nil
+}
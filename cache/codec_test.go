@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/cosiner/gohper/lib/test"
+	"github.com/cosiner/gohper/redis"
+)
+
+type codecUser struct {
+	Name string
+	Age  int
+}
+
+func TestRedisCacheCodec(t *testing.T) {
+	tt := test.Wrap(t)
+	server := newFakeRedis()
+	defer server.Close()
+	RegisterType(codecUser{})
+
+	c, err := New(REDIS, "codec=gob&addr="+server.Addr())
+	tt.Nil(err)
+	cache := c.(*RedisCache)
+	cache.Set("user", codecUser{"abc", 10})
+	cache.Set("int", 123)
+	cache.Set("str", "123")
+	tt.Eq(codecUser{"abc", 10}, cache.Get("user"))
+	tt.Eq(123, cache.Get("int"))
+	tt.Eq("123", cache.Get("str"))
+
+	var u codecUser
+	tt.Nil(cache.GetInto("user", &u))
+	tt.Eq("abc", u.Name)
+	var s string
+	tt.NNil(cache.GetInto("int", &s))
+	tt.Eq(redis.ErrNil, cache.GetInto("none", &s))
+
+	cache.SetCodec(JSONCodec)
+	cache.Set("user", &codecUser{"def", 20})
+	u = codecUser{}
+	tt.Nil(cache.GetInto("user", &u))
+	tt.Eq(codecUser{"def", 20}, u)
+	tt.Eq("def", cache.Get("user").(map[string]interface{})["Name"])
+
+	c, err = New(REDIS, "addr="+server.Addr()) // no codec by default
+	tt.Nil(err)
+	c.Set("str", "123")
+	tt.Eq("123", string(c.Get("str").([]byte)))
+	tt.Eq(ErrNoCodec, c.(*RedisCache).GetInto("str", &s))
+
+	_, err = New(REDIS, "codec=xml")
+	tt.Eq(ErrUnknowCodec, err)
+}
@@ -0,0 +1,106 @@
+package cache
+
+import "context"
+
+// CtxCache is the context-aware variant of Cache, errors of backend are
+// returned instead of swallowed, if ctx is done before operation complete,
+// ctx.Err() is returned, a nil value with nil error means key not exist
+type CtxCache interface {
+	// GetCtx return value of key
+	GetCtx(ctx context.Context, key string) (interface{}, error)
+	// SetCtx bind value to key, if key already exist, will be replaced
+	SetCtx(ctx context.Context, key string, val interface{}) error
+	// UpdateCtx only update exist key-value pair, if key not exist, return false
+	UpdateCtx(ctx context.Context, key string, val interface{}) (bool, error)
+	// RemoveCtx remove key-value pair
+	RemoveCtx(ctx context.Context, key string) error
+	// IsExistCtx check whether key exist
+	IsExistCtx(ctx context.Context, key string) (bool, error)
+	// SizeCtx return current cache count
+	SizeCtx(ctx context.Context) (int, error)
+}
+
+// WithContext return cache itself if it implement CtxCache, otherwise wrap it,
+// for wrapped cache, ctx is only checked before each operation
+func WithContext(c Cache) CtxCache {
+	if cc, is := c.(CtxCache); is {
+		return cc
+	}
+	return ctxCache{c}
+}
+
+// ctxCache wrap a Cache as CtxCache
+type ctxCache struct {
+	Cache
+}
+
+func (c ctxCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	return getCtx(ctx, c.Cache, key)
+}
+
+func (c ctxCache) SetCtx(ctx context.Context, key string, val interface{}) error {
+	return setCtx(ctx, c.Cache, key, val)
+}
+
+func (c ctxCache) UpdateCtx(ctx context.Context, key string, val interface{}) (bool, error) {
+	return updateCtx(ctx, c.Cache, key, val)
+}
+
+func (c ctxCache) RemoveCtx(ctx context.Context, key string) error {
+	return removeCtx(ctx, c.Cache, key)
+}
+
+func (c ctxCache) IsExistCtx(ctx context.Context, key string) (bool, error) {
+	return isExistCtx(ctx, c.Cache, key)
+}
+
+func (c ctxCache) SizeCtx(ctx context.Context) (int, error) {
+	return sizeCtx(ctx, c.Cache)
+}
+
+// getCtx, setCtx, updateCtx, removeCtx, isExistCtx, sizeCtx implement CtxCache
+// for in-memory cachers, operations never fail, so ctx is only checked before
+// them
+func getCtx(ctx context.Context, c Cache, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Get(key), nil
+}
+
+func setCtx(ctx context.Context, c Cache, key string, val interface{}) error {
+	err := ctx.Err()
+	if err == nil {
+		c.Set(key, val)
+	}
+	return err
+}
+
+func updateCtx(ctx context.Context, c Cache, key string, val interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return c.Update(key, val), nil
+}
+
+func removeCtx(ctx context.Context, c Cache, key string) error {
+	err := ctx.Err()
+	if err == nil {
+		c.Remove(key)
+	}
+	return err
+}
+
+func isExistCtx(ctx context.Context, c Cache, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return c.IsExist(key), nil
+}
+
+func sizeCtx(ctx context.Context, c Cache) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.Size(), nil
+}
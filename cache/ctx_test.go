@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cosiner/gohper/lib/test"
+)
+
+func testCtxCache(tt test.Test, c CtxCache) {
+	ctx := context.Background()
+	tt.Nil(c.SetCtx(ctx, "a", "1"))
+	v, err := c.GetCtx(ctx, "a")
+	tt.Nil(err)
+	tt.NNil(v)
+	v, err = c.GetCtx(ctx, "none")
+	tt.Nil(err)
+	tt.Nil(v)
+
+	success, err := c.UpdateCtx(ctx, "a", "2")
+	tt.Nil(err)
+	tt.True(success)
+	success, err = c.UpdateCtx(ctx, "b", "2")
+	tt.Nil(err)
+	tt.False(success)
+
+	exist, err := c.IsExistCtx(ctx, "a")
+	tt.Nil(err)
+	tt.True(exist)
+	size, err := c.SizeCtx(ctx)
+	tt.Nil(err)
+	tt.Eq(1, size)
+	tt.Nil(c.RemoveCtx(ctx, "a"))
+	exist, _ = c.IsExistCtx(ctx, "a")
+	tt.False(exist)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	tt.Eq(context.Canceled, c.SetCtx(canceled, "a", "1"))
+	_, err = c.GetCtx(canceled, "a")
+	tt.Eq(context.Canceled, err)
+	exist, _ = c.IsExistCtx(ctx, "a")
+	tt.False(exist)
+}
+
+func TestCtxCache(t *testing.T) {
+	tt := test.Wrap(t)
+	for _, typ := range []CacherType{RANDOM, LRU, SHARDED_LRU, LFU, ARC} {
+		c, _ := New(typ, "maxsize=10")
+		_, is := c.(CtxCache) // in-memory cachers are wrapped
+		tt.False(is)
+		testCtxCache(tt, WithContext(c))
+	}
+}
+
+func TestRedisCtxCache(t *testing.T) {
+	tt := test.Wrap(t)
+	server := newFakeRedis()
+	c, err := New(REDIS, "codec=gob&addr="+server.Addr())
+	tt.Nil(err)
+	rc := c.(*RedisCache)
+	testCtxCache(tt, rc)
+
+	tc, err := New(TIERED, "l1.maxsize=10&l2.addr="+server.Addr())
+	tt.Nil(err)
+	testCtxCache(tt, tc.(CtxCache))
+	tc.(Destroyer).Destroy()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	_, err = rc.RealStore().QueryCtx(ctx, "DEBUG", "SLEEP", "0.5")
+	tt.Eq(context.DeadlineExceeded, err)
+	tt.True(time.Since(begin) < 250*time.Millisecond)
+
+	server.Close()
+	rc.RealStore().Destroy() // drop pooled connections
+	_, err = rc.GetCtx(context.Background(), "a")
+	tt.NNil(err) // network error is returned
+	tt.Nil(rc.Get("a"))
+}
@@ -1,97 +1,300 @@
 package cache
 
-// import (
-// 	"time"
-
-// 	. "github.com/cosiner/gohper/lib/errors"
-// 	"github.com/cosiner/gohper/lib/types"
-
-// 	"sync"
-// )
-
-// type nodeList struct {
-// 	node *node
-// 	next *nodeList
-// }
-
-// type node struct {
-// 	time, expire int64
-// 	key          string
-// 	val          []interface{}
-// }
-
-// func (n *node) isExpired() bool {
-// 	return n.isExpiredUntil(timeNow())
-// }
-
-// func (n *node) isExpiredUntil(t int64) bool {
-// 	return n.expire != -1 && n.time+n.expire < t
-// }
-
-// type expireCache struct {
-// 	lock   *sync.RWMutex
-// 	values map[string]*node
-// 	head   *nodeList
-// 	tail   *nodeList
-// }
-
-// func (ec *expireCache) Init(conf string) error {
-// 	pair := types.ParsePair(conf, "=")
-// 	if pair.HasValue() && pair.Key == "expire" {
-// 		if expire, err := pair.IntValue(); err == nil {
-// 			ec.expire = expire
-// 			return nil
-// 		}
-// 	}
-// 	return Errorf("Wrong format:%s", conf)
-// }
-
-// func (ec *expireCache) Get(key string) (val interface{}) {
-// 	ec.lock.RLock()
-// 	node := ec.values[key]
-// 	ec.lock.RUnlock()
-// 	if !node.isExpired() {
-// 		val = node.val
-// 	}
-// 	return
-// }
-
-// func timeNow() int64 {
-// 	return time.Now().UnixNano()
-// }
-
-// func (ec *expireCache) Set(key string, val interface{}, expire int64) {
-// 	var time int64
-// 	if expire == 0 {
-// 		return
-// 	} else if expire < 0 {
-// 		time, expire = 0, -1
-// 	} else {
-// 		time = timeNow()
-// 	}
-// 	node := &node{key: key, val: val, time: time, expire: expire}
-// 	listNode := &listNode{node: node}
-// 	ec.lock.Lock()
-// 	ec.values[key] = node
-// 	if ec.tail == nil {
-// 		ec.tail = listNode
-// 	} else {
-// 		ec.tail.next = listNode
-// 	}
-// 	ec.lock.Unlock()
-// }
-
-// // Update only update exist key-value pair, if key not exist, return false
-// func (ec *expireCache) Update(key string, val interface{}) bool {}
-
-// // Remove key-value pair
-// func (ec *expireCache) Remove(key string) {}
-
-// // IsExist check whether item exist
-// func (ec *expireCache) IsExist(key string) bool {}
-
-// // Len return current cache count
-// func (ec *expireCache) Len() int {}
-
-// // Cap return cache capacity
-// func (ec *expireCache) Cap() int {}
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cosiner/gohper/config"
+)
+
+const (
+	// DEF_INTERVAL is the default interval of expire cache's janitor
+	DEF_INTERVAL = time.Minute
+)
+
+// ExpireCache is a cache that key-value pair can be bind with a time to live
+type ExpireCache interface {
+	Cache
+	// SetWithExpire add an key-value to cache, it will be expired after ttl,
+	// if ttl <= 0, it will never expire
+	SetWithExpire(key string, val interface{}, ttl time.Duration)
+	// Destroy stop the background janitor, it's safe to call it more than once
+	Destroy()
+}
+
+// expireEntry is a item of expire cache
+type expireEntry struct {
+	val    interface{}
+	expire int64 // unix nano time of expiration, 0 means never
+}
+
+// isExpiredAt check whether entry is expired at given unix nano time
+func (ee *expireEntry) isExpiredAt(now int64) bool {
+	return ee.expire != 0 && ee.expire <= now
+}
+
+// expireCache is a cacher that remove expired entries lazily when access it,
+// and a background janitor will remove all expired entries periodically
+type expireCache struct {
+	instrument
+	tagIndex
+	periodicSnapshot
+	values map[string]*expireEntry
+	ttl    time.Duration
+	lock   *sync.RWMutex
+	stop   chan struct{}
+	once   sync.Once // close stop only once
+}
+
+// Init init expire cacher, config format like expire=30s&interval=1m,
+// expire is the default time to live of entry, if it's not set, entries set by
+// Set will never expire, interval is the janitor's interval to remove expired
+// entries, default is DEF_INTERVAL
+func (ec *expireCache) Init(conf string) error {
+	return ec.InitVals(conf, nil)
+}
+
+// InitVals init expire cacher with values, all of them use default ttl
+func (ec *expireCache) InitVals(conf string, values map[string]interface{}) (err error) {
+	var ttl, interval time.Duration
+	if ttl, interval, err = parseExpire(conf); err == nil {
+		ec.init(ttl, interval, values)
+	}
+	return
+}
+
+// init setup expire cacher and start the janitor
+func (ec *expireCache) init(ttl, interval time.Duration, values map[string]interface{}) {
+	ec.ttl = ttl
+	ec.values = make(map[string]*expireEntry, len(values))
+	ec.lock = new(sync.RWMutex)
+	ec.stop = make(chan struct{})
+	expire := expireAt(ttl)
+	for k, v := range values {
+		ec.values[k] = &expireEntry{val: v, expire: expire}
+	}
+	go ec.janitor(interval)
+}
+
+// parseExpire parse default ttl and janitor interval from config string
+func parseExpire(conf string) (ttl, interval time.Duration, err error) {
+	c := config.NewConfig(config.LINE)
+	c.ParseString(conf)
+	interval = DEF_INTERVAL
+	if s, has := c.Val("expire"); has {
+		if ttl, err = time.ParseDuration(s); err != nil {
+			return 0, 0, ErrWrongFormat
+		}
+	}
+	if s, has := c.Val("interval"); has {
+		if interval, err = time.ParseDuration(s); err != nil || interval <= 0 {
+			return 0, 0, ErrWrongFormat
+		}
+	}
+	return
+}
+
+// expireAt return the expiration unix nano time of ttl from now
+func expireAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixNano()
+}
+
+// janitor remove expired entries every interval until cache is destroyed
+func (ec *expireCache) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for {
+		select {
+		case <-ticker.C:
+			ec.RemoveExpired()
+		case <-ec.stop:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// RemoveExpired remove all expired entries
+func (ec *expireCache) RemoveExpired() {
+	var expired map[string]interface{}
+	now := time.Now().UnixNano()
+	ec.lock.Lock()
+	for k, e := range ec.values {
+		if e.isExpiredAt(now) {
+			if expired == nil {
+				expired = make(map[string]interface{})
+			}
+			expired[k] = e.val
+			delete(ec.values, k)
+			ec.untag(k)
+		}
+	}
+	ec.lock.Unlock()
+	for k, v := range expired {
+		ec.evict(k, v)
+	}
+}
+
+// Destroy stop the background janitor and periodic snapshot, cache can still
+// be used, but expired entries will only be removed when access them
+func (ec *expireCache) Destroy() {
+	ec.once.Do(func() {
+		close(ec.stop)
+	})
+	ec.StopSnapshot()
+}
+
+// Size return current cache count, expired entries not removed yet is also
+// counted
+func (ec *expireCache) Size() int {
+	ec.lock.RLock()
+	size := len(ec.values)
+	ec.lock.RUnlock()
+	return size
+}
+
+// Cap return cache capacity, expire cache has no limit, so always return -1
+func (ec *expireCache) Cap() int {
+	return -1
+}
+
+// Get return value of the key, if not exist or expired, nil returned
+func (ec *expireCache) Get(key string) (val interface{}) {
+	now := time.Now().UnixNano()
+	ec.lock.RLock()
+	entry, has := ec.values[key]
+	ec.lock.RUnlock()
+	if has {
+		if !entry.isExpiredAt(now) {
+			val = entry.val
+		} else {
+			ec.removeExpired(key, now)
+			has = false
+		}
+	}
+	ec.recordGet(has)
+	return
+}
+
+// removeExpired remove key only if it's still expired
+func (ec *expireCache) removeExpired(key string, now int64) {
+	ec.lock.Lock()
+	entry, has := ec.values[key]
+	if has = has && entry.isExpiredAt(now); has {
+		delete(ec.values, key)
+		ec.untag(key)
+	}
+	ec.lock.Unlock()
+	if has {
+		ec.evict(key, entry.val)
+	}
+}
+
+// IsExist check whether key exist and not expired
+func (ec *expireCache) IsExist(key string) bool {
+	now := time.Now().UnixNano()
+	ec.lock.RLock()
+	entry, has := ec.values[key]
+	ec.lock.RUnlock()
+	return has && !entry.isExpiredAt(now)
+}
+
+// Remove remove key and it's value from cache
+func (ec *expireCache) Remove(key string) {
+	ec.lock.Lock()
+	_, has := ec.values[key]
+	delete(ec.values, key)
+	ec.untag(key)
+	ec.lock.Unlock()
+	if has {
+		ec.recordRemove()
+	}
+}
+
+// Set add an key-value to cache with default ttl
+func (ec *expireCache) Set(key string, val interface{}) {
+	ec.SetWithExpire(key, val, ec.ttl)
+}
+
+// SetWithExpire add an key-value to cache with given ttl, if ttl <= 0,
+// it will never expire
+func (ec *expireCache) SetWithExpire(key string, val interface{}, ttl time.Duration) {
+	ec.set(key, val, ttl, nil)
+}
+
+// set add an key-value to cache with given ttl and replace tags of key
+func (ec *expireCache) set(key string, val interface{}, ttl time.Duration, tags []string) {
+	entry := &expireEntry{val: val, expire: expireAt(ttl)}
+	ec.lock.Lock()
+	ec.values[key] = entry
+	ec.retag(key, tags)
+	ec.lock.Unlock()
+	ec.recordSet()
+}
+
+// Update only update existed and not expired key-value, the expiration time
+// will not be changed, returned value show whether it's successed
+func (ec *expireCache) Update(key string, val interface{}) (ret bool) {
+	now := time.Now().UnixNano()
+	ec.lock.Lock()
+	if entry, has := ec.values[key]; has && !entry.isExpiredAt(now) {
+		ec.values[key] = &expireEntry{val: val, expire: entry.expire}
+		ret = true
+	}
+	ec.lock.Unlock()
+	if ret {
+		ec.recordSet()
+	}
+	return
+}
+
+// Dump write all entries not expired to writer with their remaining time to live
+func (ec *expireCache) Dump(w io.Writer) error {
+	now := time.Now().UnixNano()
+	ec.lock.RLock()
+	entries := make([]snapshotEntry, 0, len(ec.values))
+	for k, e := range ec.values {
+		if !e.isExpiredAt(now) {
+			entries = append(entries, snapshotEntry{Key: k, Val: e.val, TTL: remainingTTL(e.expire, now)})
+		}
+	}
+	ec.lock.RUnlock()
+	return dumpEntries(w, entries)
+}
+
+// Load read entries from reader and add them to cache with their remaining
+// time to live
+func (ec *expireCache) Load(r io.Reader) error {
+	return loadEntries(r, func(e *snapshotEntry) {
+		ec.SetWithExpire(e.Key, e.Val, e.TTL)
+	})
+}
+
+// SetWithTags add an key-value to cache, and bind it to tags
+func (ec *expireCache) SetWithTags(key string, val interface{}, tags ...string) {
+	ec.set(key, val, ec.ttl, tags)
+}
+
+// InvalidateTag remove all keys bind to tag
+func (ec *expireCache) InvalidateTag(tag string) {
+	removeKeys(ec, ec.tagged(tag))
+}
+
+// RemovePrefix remove all keys start with prefix
+func (ec *expireCache) RemovePrefix(prefix string) {
+	removePrefix(ec, ec.keys(), prefix)
+}
+
+// keys return all keys in cache
+func (ec *expireCache) keys() []string {
+	ec.lock.RLock()
+	keys := make([]string, 0, len(ec.values))
+	for k := range ec.values {
+		keys = append(keys, k)
+	}
+	ec.lock.RUnlock()
+	return keys
+}
@@ -0,0 +1,284 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeRedis is a in-process redis server that support a small subset of
+// commands for test
+type fakeRedis struct {
+	lock     sync.Mutex
+	listener net.Listener
+	values   map[string][]byte
+	sets     map[string]map[string]bool
+	subs     map[string][]*fakeRedisConn
+}
+
+// fakeRedisConn is a client connection of fake redis
+type fakeRedisConn struct {
+	lock sync.Mutex
+	conn net.Conn
+	w    *bufio.Writer
+}
+
+// newFakeRedis start a fake redis server listen on random local port
+func newFakeRedis() *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	fr := &fakeRedis{
+		listener: l,
+		values:   make(map[string][]byte),
+		sets:     make(map[string]map[string]bool),
+		subs:     make(map[string][]*fakeRedisConn),
+	}
+	go fr.serve()
+	return fr
+}
+
+// Addr return listen address of server
+func (fr *fakeRedis) Addr() string {
+	return fr.listener.Addr().String()
+}
+
+// Close stop the server
+func (fr *fakeRedis) Close() {
+	fr.listener.Close()
+}
+
+// dropSubscribers close connections of all subscribers
+func (fr *fakeRedis) dropSubscribers() {
+	fr.lock.Lock()
+	for ch, subs := range fr.subs {
+		for _, s := range subs {
+			s.conn.Close()
+		}
+		delete(fr.subs, ch)
+	}
+	fr.lock.Unlock()
+}
+
+// subscribers return count of subscribers of channel
+func (fr *fakeRedis) subscribers(channel string) int {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	return len(fr.subs[channel])
+}
+
+func (fr *fakeRedis) serve() {
+	for {
+		c, err := fr.listener.Accept()
+		if err != nil {
+			return
+		}
+		go fr.handle(c)
+	}
+}
+
+func (fr *fakeRedis) handle(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	conn := &fakeRedisConn{conn: c, w: bufio.NewWriter(c)}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if strings.ToUpper(args[0]) == "DEBUG" && len(args) == 3 { // DEBUG SLEEP seconds
+			seconds, _ := strconv.ParseFloat(args[2], 64)
+			time.Sleep(time.Duration(seconds * float64(time.Second)))
+		}
+		fr.lock.Lock() // always lock server before connection
+		conn.lock.Lock()
+		fr.exec(conn, strings.ToUpper(args[0]), args[1:])
+		conn.w.Flush()
+		conn.lock.Unlock()
+		fr.lock.Unlock()
+	}
+}
+
+// readCommand read a command in RESP array format
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (c *fakeRedisConn) status(s string) { fmt.Fprintf(c.w, "+%s\r\n", s) }
+func (c *fakeRedisConn) error(s string)  { fmt.Fprintf(c.w, "-%s\r\n", s) }
+func (c *fakeRedisConn) int(n int)       { fmt.Fprintf(c.w, ":%d\r\n", n) }
+func (c *fakeRedisConn) nil()            { c.w.WriteString("$-1\r\n") }
+func (c *fakeRedisConn) array(n int)     { fmt.Fprintf(c.w, "*%d\r\n", n) }
+func (c *fakeRedisConn) bulk(s string)   { fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(s), s) }
+
+// exec execute a command, both server and connection lock must be held
+func (fr *fakeRedis) exec(c *fakeRedisConn, cmd string, args []string) {
+	switch cmd {
+	case "PING":
+		c.status("PONG")
+	case "GET":
+		if v, has := fr.values[args[0]]; has {
+			c.bulk(string(v))
+		} else {
+			c.nil()
+		}
+	case "SET": // only support XX option
+		if _, has := fr.values[args[0]]; !has && len(args) > 2 && strings.ToUpper(args[2]) == "XX" {
+			c.nil()
+			break
+		}
+		fr.values[args[0]] = []byte(args[1])
+		c.status("OK")
+	case "EVAL": // only support untag script
+		if args[0] != _UNTAG_SCRIPT {
+			c.error("ERR unknown script")
+			break
+		}
+		key, tagsKey, prefix := args[2], args[3], args[4]
+		for t := range fr.sets[tagsKey] {
+			if set := fr.sets[prefix+t]; set != nil {
+				if delete(set, key); len(set) == 0 {
+					delete(fr.sets, prefix+t)
+				}
+			}
+		}
+		delete(fr.sets, tagsKey)
+		fr.exec(c, strings.ToUpper(args[5]), args[6:])
+	case "DBSIZE":
+		c.int(len(fr.values) + len(fr.sets))
+	case "DEBUG":
+		c.status("OK")
+	case "SETEX":
+		fr.values[args[0]] = []byte(args[2])
+		c.status("OK")
+	case "EXISTS":
+		_, has := fr.values[args[0]]
+		if has {
+			c.int(1)
+		} else {
+			c.int(0)
+		}
+	case "DEL":
+		n := 0
+		for _, k := range args {
+			if _, has := fr.values[k]; has {
+				delete(fr.values, k)
+				n++
+			} else if _, has := fr.sets[k]; has {
+				delete(fr.sets, k)
+				n++
+			}
+		}
+		c.int(n)
+	case "SADD":
+		set := fr.sets[args[0]]
+		if set == nil {
+			set = make(map[string]bool)
+			fr.sets[args[0]] = set
+		}
+		n := 0
+		for _, m := range args[1:] {
+			if !set[m] {
+				set[m] = true
+				n++
+			}
+		}
+		c.int(n)
+	case "SREM":
+		set, n := fr.sets[args[0]], 0
+		for _, m := range args[1:] {
+			if set[m] {
+				delete(set, m)
+				n++
+			}
+		}
+		if set != nil && len(set) == 0 {
+			delete(fr.sets, args[0])
+		}
+		c.int(n)
+	case "SMEMBERS":
+		set := fr.sets[args[0]]
+		c.array(len(set))
+		for m := range set {
+			c.bulk(m)
+		}
+	case "SCAN": // only support pattern of escaped prefix followed by *, return all in one batch
+		pattern := args[2]
+		prefix := strings.NewReplacer(`\`, `\`, `\*`, "*", `\?`, "?", `\[`, "[", `\]`, "]").
+			Replace(pattern[:len(pattern)-1])
+		var keys []string
+		for k := range fr.values {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		c.array(2)
+		c.bulk("0")
+		c.array(len(keys))
+		for _, k := range keys {
+			c.bulk(k)
+		}
+	case "PUBLISH":
+		subs := fr.subs[args[0]]
+		for _, s := range subs {
+			if s != c {
+				s.lock.Lock()
+			}
+			s.array(3)
+			s.bulk("message")
+			s.bulk(args[0])
+			s.bulk(args[1])
+			s.w.Flush()
+			if s != c {
+				s.lock.Unlock()
+			}
+		}
+		c.int(len(subs))
+	case "SUBSCRIBE":
+		for i, ch := range args {
+			fr.subs[ch] = append(fr.subs[ch], c)
+			c.array(3)
+			c.bulk("subscribe")
+			c.bulk(ch)
+			c.int(i + 1)
+		}
+	case "UNSUBSCRIBE":
+		for ch, subs := range fr.subs {
+			for i, s := range subs {
+				if s == c {
+					fr.subs[ch] = append(subs[:i], subs[i+1:]...)
+					c.array(3)
+					c.bulk("unsubscribe")
+					c.bulk(ch)
+					c.int(0)
+					break
+				}
+			}
+		}
+	default:
+		c.error("ERR unknown command '" + cmd + "'")
+	}
+}
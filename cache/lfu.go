@@ -0,0 +1,253 @@
+package cache
+
+import (
+	"container/list"
+	"io"
+	"sort"
+	"sync"
+)
+
+// lfuCacheEntry is a item of lfu cache
+type lfuCacheEntry struct {
+	key  string
+	val  interface{}
+	freq int
+	elem *list.Element // element in frequency list
+}
+
+// lfuCache is a cacher use lfu eliminate algorithm, entries with same access
+// frequency are eliminated in lru order
+type lfuCache struct {
+	instrument
+	tagIndex
+	periodicSnapshot
+	entries map[string]*lfuCacheEntry
+	freqs   map[int]*list.List // access frequency to entries
+	minFreq int
+	maxSize int
+	lock    *sync.Mutex
+}
+
+// Init init lfu cacher
+func (lc *lfuCache) Init(config string) error {
+	return lc.InitVals(config, nil)
+}
+
+// InitVals init lfu cacher with initial values
+func (lc *lfuCache) InitVals(config string, values map[string]interface{}) (err error) {
+	if lc.maxSize, err = parseMaxSize(config); err == nil {
+		fixSize(values, lc.maxSize)
+		lc.entries = make(map[string]*lfuCacheEntry, lc.maxSize)
+		lc.freqs = make(map[int]*list.List)
+		lc.lock = new(sync.Mutex)
+		for k, v := range values {
+			lc.add(k, v)
+		}
+	}
+	return
+}
+
+// Size return current cache count
+func (lc *lfuCache) Size() int {
+	lc.lock.Lock()
+	size := len(lc.entries)
+	lc.lock.Unlock()
+	return size
+}
+
+// Cap return cache capacity
+func (lc *lfuCache) Cap() int {
+	return lc.maxSize
+}
+
+// Get return value of the key, if not exist, nil returned
+func (lc *lfuCache) Get(key string) (val interface{}) {
+	lc.lock.Lock()
+	entry, has := lc.entries[key]
+	if has {
+		val = entry.val
+		lc.touch(entry)
+	}
+	lc.lock.Unlock()
+	lc.recordGet(has)
+	return
+}
+
+// IsExist check whether key exist, it don't affect access frequency
+func (lc *lfuCache) IsExist(key string) bool {
+	lc.lock.Lock()
+	_, has := lc.entries[key]
+	lc.lock.Unlock()
+	return has
+}
+
+// Remove remove key and it's value from cache
+func (lc *lfuCache) Remove(key string) {
+	lc.lock.Lock()
+	entry, has := lc.entries[key]
+	if has {
+		lc.unlink(entry)
+		delete(lc.entries, key)
+		lc.untag(key)
+	}
+	lc.lock.Unlock()
+	if has {
+		lc.recordRemove()
+	}
+}
+
+// Set add an key-value to cache, if key already exist in cache, update it's value
+func (lc *lfuCache) Set(key string, val interface{}) {
+	lc.set(key, val, true, nil)
+}
+
+// Update only update existed key-value, returned value show whether it's successed
+func (lc *lfuCache) Update(key string, val interface{}) bool {
+	return lc.set(key, val, false, nil)
+}
+
+// set do actually update cache, update is also considered as an access, if
+// forceSet, tags of key are replaced by tags
+func (lc *lfuCache) set(key string, val interface{}, forceSet bool, tags []string) (ret bool) {
+	var evicted *lfuCacheEntry
+	lc.lock.Lock()
+	if entry, has := lc.entries[key]; has {
+		entry.val = val
+		lc.touch(entry)
+		ret = true
+	} else if forceSet {
+		if len(lc.entries) == lc.maxSize {
+			evicted = lc.evictOne()
+		}
+		lc.add(key, val)
+		ret = true
+	}
+	if ret && forceSet {
+		lc.retag(key, tags)
+	}
+	lc.lock.Unlock()
+	if ret {
+		lc.recordSet()
+	}
+	if evicted != nil {
+		lc.evict(evicted.key, evicted.val)
+	}
+	return
+}
+
+// add add a new entry with frequency 1
+func (lc *lfuCache) add(key string, val interface{}) {
+	entry := &lfuCacheEntry{key: key, val: val, freq: 1}
+	lc.entries[key] = entry
+	lc.link(entry)
+	lc.minFreq = 1
+}
+
+// touch increase entry's access frequency
+func (lc *lfuCache) touch(entry *lfuCacheEntry) {
+	freq := entry.freq
+	lc.unlink(entry)
+	if lc.minFreq == freq && lc.freqs[freq] == nil {
+		lc.minFreq++
+	}
+	entry.freq++
+	lc.link(entry)
+}
+
+// link push entry to front of it's frequency list
+func (lc *lfuCache) link(entry *lfuCacheEntry) {
+	l := lc.freqs[entry.freq]
+	if l == nil {
+		l = list.New()
+		lc.freqs[entry.freq] = l
+	}
+	entry.elem = l.PushFront(entry)
+}
+
+// unlink remove entry from it's frequency list, empty list will be removed
+func (lc *lfuCache) unlink(entry *lfuCacheEntry) {
+	l := lc.freqs[entry.freq]
+	l.Remove(entry.elem)
+	if l.Len() == 0 {
+		delete(lc.freqs, entry.freq)
+	}
+}
+
+// evictOne remove the least recently used entry of least frequency
+func (lc *lfuCache) evictOne() *lfuCacheEntry {
+	l := lc.freqs[lc.minFreq]
+	if l == nil { // min frequency list is removed by Remove, find again
+		lc.minFreq = 0
+		for f := range lc.freqs {
+			if lc.minFreq == 0 || f < lc.minFreq {
+				lc.minFreq = f
+			}
+		}
+		l = lc.freqs[lc.minFreq]
+	}
+	entry := l.Back().Value.(*lfuCacheEntry)
+	lc.unlink(entry)
+	delete(lc.entries, entry.key)
+	lc.untag(entry.key)
+	return entry
+}
+
+// Dump write all entries to writer with their access frequency, from least
+// frequently used to most frequently used
+func (lc *lfuCache) Dump(w io.Writer) error {
+	lc.lock.Lock()
+	entries := make([]snapshotEntry, 0, len(lc.entries))
+	for freq, l := range lc.freqs {
+		for elem := l.Back(); elem != nil; elem = elem.Prev() {
+			entry := elem.Value.(*lfuCacheEntry)
+			entries = append(entries, snapshotEntry{Key: entry.key, Val: entry.val, Freq: freq})
+		}
+	}
+	lc.lock.Unlock()
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Freq < entries[j].Freq
+	})
+	return dumpEntries(w, entries)
+}
+
+// Load read entries from reader and add them to cache, access frequency is
+// restored
+func (lc *lfuCache) Load(r io.Reader) error {
+	return loadEntries(r, func(e *snapshotEntry) {
+		lc.Set(e.Key, e.Val)
+		lc.lock.Lock()
+		if entry, has := lc.entries[e.Key]; has && e.Freq > entry.freq {
+			lc.unlink(entry)
+			entry.freq = e.Freq
+			lc.link(entry)
+			lc.minFreq = 0 // find again when evict
+		}
+		lc.lock.Unlock()
+	})
+}
+
+// SetWithTags add an key-value to cache, and bind it to tags
+func (lc *lfuCache) SetWithTags(key string, val interface{}, tags ...string) {
+	lc.set(key, val, true, tags)
+}
+
+// InvalidateTag remove all keys bind to tag
+func (lc *lfuCache) InvalidateTag(tag string) {
+	removeKeys(lc, lc.tagged(tag))
+}
+
+// RemovePrefix remove all keys start with prefix
+func (lc *lfuCache) RemovePrefix(prefix string) {
+	removePrefix(lc, lc.keys(), prefix)
+}
+
+// keys return all keys in cache
+func (lc *lfuCache) keys() []string {
+	lc.lock.Lock()
+	keys := make([]string, 0, len(lc.entries))
+	for k := range lc.entries {
+		keys = append(keys, k)
+	}
+	lc.lock.Unlock()
+	return keys
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/cosiner/gohper/lib/errors"
+)
+
+// Loader load value of key when it's missing in cache, nil value and nil error
+// means there is no value for the key, panic of loader is returned as error
+type Loader func(key string) (interface{}, error)
+
+// loadCall is a in-flight or completed loader call
+type loadCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// negative is a cached loader result of nil value or error
+type negative struct {
+	err error
+}
+
+// Loading is a cache wrapper that load value use loader when key is missing,
+// concurrent load of same key will be merged to one loader call, nil value
+// and error returned by loader will be cached for a while to protect backend
+type Loading struct {
+	stats     instrument
+	cache     Cache
+	loader    Loader
+	negatives *expireCache
+	negExpire time.Duration
+	lock      sync.Mutex
+	calls     map[string]*loadCall
+}
+
+// NewLoading create a loading cache wrapper from an exist cache, negExpire is
+// the time to cache nil value and error returned by loader, if negExpire <= 0,
+// they will not be cached
+func NewLoading(cache Cache, loader Loader, negExpire time.Duration) *Loading {
+	negatives := new(expireCache)
+	interval := negExpire
+	if interval <= 0 {
+		interval = DEF_INTERVAL
+	}
+	negatives.init(0, interval, nil)
+	return &Loading{
+		cache:     cache,
+		loader:    loader,
+		negatives: negatives,
+		negExpire: negExpire,
+		calls:     make(map[string]*loadCall),
+	}
+}
+
+// Cache return the underlying cache
+func (l *Loading) Cache() Cache {
+	return l.cache
+}
+
+// Get return value of the key, if it's not in cache, loader will be called to
+// load it, for negative results, nil value and loader's error is returned
+func (l *Loading) Get(key string) (interface{}, error) {
+	if val := l.cache.Get(key); val != nil {
+		return val, nil
+	}
+	if neg := l.negatives.Get(key); neg != nil {
+		return nil, neg.(negative).err
+	}
+	return l.load(key, false)
+}
+
+// Stats return statistics of underlying cache with loader statistics
+func (l *Loading) Stats() Stats {
+	s, ls := l.cache.Stats(), l.stats.Stats()
+	s.Loads, s.LoadErrors, s.TotalLoadTime = ls.Loads, ls.LoadErrors, ls.TotalLoadTime
+	return s
+}
+
+// Refresh reload value of the key asynchronously, the old value is still
+// available until load is completed, if loader failed or return nil value,
+// old value is retained
+func (l *Loading) Refresh(key string) {
+	go l.load(key, true)
+}
+
+// Remove remove key from cache and it's cached negative result, result of
+// in-flight load of the key will not be stored
+func (l *Loading) Remove(key string) {
+	l.lock.Lock()
+	delete(l.calls, key)
+	l.cache.Remove(key)
+	l.negatives.Remove(key)
+	l.lock.Unlock()
+}
+
+// Destroy stop the background janitor of cached negative results
+func (l *Loading) Destroy() {
+	l.negatives.Destroy()
+}
+
+// load call loader to load value of key, if there is already a call for the key,
+// wait and use it's result, result is stored only if the key is not removed
+// during load
+func (l *Loading) load(key string, refresh bool) (interface{}, error) {
+	l.lock.Lock()
+	if c, has := l.calls[key]; has {
+		l.lock.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := new(loadCall)
+	c.wg.Add(1)
+	l.calls[key] = c
+	l.lock.Unlock()
+	defer c.wg.Done()
+
+	c.val, c.err = l.call(key)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.calls[key] != c {
+		return c.val, c.err
+	}
+	delete(l.calls, key)
+	switch {
+	case c.err == nil && c.val != nil:
+		l.cache.Set(key, c.val)
+		l.negatives.Remove(key)
+	case refresh:
+	default:
+		if c.err == nil {
+			l.cache.Remove(key)
+		}
+		if l.negExpire > 0 {
+			l.negatives.SetWithExpire(key, negative{c.err}, l.negExpire)
+		}
+	}
+	return c.val, c.err
+}
+
+// call call loader and record statistics, panic of loader is converted to error
+func (l *Loading) call(key string) (val interface{}, err error) {
+	start := time.Now()
+	defer func() {
+		if e := recover(); e != nil {
+			val, err = nil, Errorf("Loader panic:%v", e)
+		}
+		l.stats.recordLoad(time.Since(start), err)
+	}()
+	return l.loader(key)
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/cosiner/gohper/lib/errors"
+	"github.com/cosiner/gohper/lib/test"
+)
+
+func TestLoadingDeduplicate(t *testing.T) {
+	tt := test.Wrap(t)
+	var calls int32
+	start := make(chan struct{})
+	c, _ := New(LRU, "maxsize=10")
+	l := NewLoading(c, func(key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-start
+		return "v" + key, nil
+	}, 0)
+	defer l.Destroy()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := l.Get("a")
+			tt.Nil(err)
+			tt.Eq("va", val)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(start)
+	wg.Wait()
+	tt.Eq(int32(1), atomic.LoadInt32(&calls))
+	tt.Eq("va", c.Get("a"))
+}
+
+func TestLoadingNegative(t *testing.T) {
+	tt := test.Wrap(t)
+	var calls int32
+	errLoad := Err("load failed")
+	c, _ := New(LRU, "maxsize=10")
+	l := NewLoading(c, func(key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		if key == "err" {
+			return nil, errLoad
+		}
+		return nil, nil
+	}, 50*time.Millisecond)
+	defer l.Destroy()
+
+	for i := 0; i < 3; i++ {
+		val, err := l.Get("err")
+		tt.Eq(nil, val)
+		tt.Eq(errLoad, err)
+		val, err = l.Get("none")
+		tt.Eq(nil, val)
+		tt.Nil(err)
+	}
+	tt.Eq(int32(2), atomic.LoadInt32(&calls))
+	s := l.Stats()
+	tt.Eq(uint64(2), s.Loads)
+	tt.Eq(uint64(1), s.LoadErrors)
+	tt.Eq(uint64(6), s.Misses)
+
+	time.Sleep(60 * time.Millisecond)
+	l.Get("err")
+	tt.Eq(int32(3), atomic.LoadInt32(&calls))
+	l.Remove("err")
+	l.Get("err")
+	tt.Eq(int32(4), atomic.LoadInt32(&calls))
+}
+
+// notifyCache notify each Set through channel
+type notifyCache struct {
+	Cache
+	sets chan string
+}
+
+func (c notifyCache) Set(key string, val interface{}) {
+	c.Cache.Set(key, val)
+	c.sets <- key
+}
+
+func TestLoadingRefresh(t *testing.T) {
+	tt := test.Wrap(t)
+	vals := make(chan interface{}, 1)
+	lru, _ := New(LRU, "maxsize=10")
+	c := notifyCache{lru, make(chan string, 1)}
+	l := NewLoading(c, func(key string) (interface{}, error) {
+		return <-vals, nil
+	}, time.Minute)
+	defer l.Destroy()
+
+	vals <- 1
+	val, _ := l.Get("a")
+	tt.Eq(1, val)
+	<-c.sets
+	vals <- 2
+	l.Refresh("a")
+	tt.Eq("a", <-c.sets)
+	val, _ = l.Get("a")
+	tt.Eq(2, val)
+
+	vals <- nil
+	l.load("a", true)
+	val, err := l.Get("a")
+	tt.Nil(err)
+	tt.Eq(2, val)
+}
+
+func TestLoadingPanic(t *testing.T) {
+	tt := test.Wrap(t)
+	var calls int32
+	c, _ := New(LRU, "maxsize=10")
+	l := NewLoading(c, func(key string) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("boom")
+		}
+		return "v" + key, nil
+	}, 0)
+	defer l.Destroy()
+
+	val, err := l.Get("a")
+	tt.Nil(val)
+	tt.NNil(err)
+	s := l.Stats()
+	tt.Eq(uint64(1), s.LoadErrors)
+
+	val, err = l.Get("a")
+	tt.Nil(err)
+	tt.Eq("va", val)
+}
+
+func TestLoadingRemove(t *testing.T) {
+	tt := test.Wrap(t)
+	start, loading := make(chan struct{}), make(chan struct{})
+	c, _ := New(LRU, "maxsize=10")
+	l := NewLoading(c, func(key string) (interface{}, error) {
+		loading <- struct{}{}
+		<-start
+		return "v" + key, nil
+	}, 0)
+	defer l.Destroy()
+
+	done := make(chan struct{})
+	go func() {
+		val, err := l.Get("a")
+		tt.Nil(err)
+		tt.Eq("va", val)
+		close(done)
+	}()
+	<-loading
+	l.Remove("a")
+	close(start)
+	<-done
+	tt.Nil(c.Get("a"))
+}
@@ -1,25 +1,25 @@
 package cache
 
 import (
-	"sync"
-
 	"container/list"
+	"io"
+	"sync"
 )
 
 // lruCacheEntry is a item of lru cache
 type lruCacheEntry struct {
-	key string
-	val interface{}
-}
-
-// init init a cache entry
-func (ce *lruCacheEntry) init(key string, val interface{}) {
-	ce.key = key
-	ce.val = val
+	key  string
+	val  interface{}
+	cost int64 // memory cost, only measured when cache is bounded by maxbytes
 }
 
-// lruCache is a cacher use lru eliminate algorithm
+// lruCache is a cacher use lru eliminate algorithm, it's bounded by entry
+// count or memory cost of entries
 type lruCache struct {
+	instrument
+	tagIndex
+	periodicSnapshot
+	sizeBudget
 	cacheData  *list.List
 	cacheIndex map[string]*list.Element
 	maxSize    int
@@ -27,29 +27,37 @@ type lruCache struct {
 }
 
 // Init init lru cacher
-func (lc *lruCache) Init(config string) (err error) {
-	lc.cacheData = list.New()
-	if lc.maxSize, err = parseMaxSize(config); err == nil {
-		lc.cacheIndex = make(map[string]*list.Element, lc.maxSize)
-		lc.lock = new(sync.RWMutex)
-	}
-	return
+func (lc *lruCache) Init(config string) error {
+	return lc.InitVals(config, nil)
 }
 
 // Init init lru cacher
 func (lc *lruCache) InitVals(config string, values map[string]interface{}) (err error) {
-	lc.cacheData = list.New()
-	if lc.maxSize, err = parseMaxSize(config); err == nil {
-		fixSize(values, lc.maxSize)
-		lc.cacheIndex = make(map[string]*list.Element, lc.maxSize)
-		lc.lock = new(sync.RWMutex)
-		for k, v := range values {
-			lc.cacheIndex[k] = lc.cacheData.PushFront(v)
-		}
+	var maxsize int
+	if maxsize, lc.maxBytes, err = parseLimits(config); err == nil {
+		lc.init(maxsize, values)
 	}
 	return
 }
 
+// init setup lru cacher with max size and initial values, if cache is bounded
+// by maxbytes, maxsize is 0 and maxBytes must be set before
+func (lc *lruCache) init(maxsize int, values map[string]interface{}) {
+	if maxsize > 0 {
+		fixSize(values, maxsize)
+	}
+	lc.maxSize = maxsize
+	lc.cacheData = list.New()
+	lc.cacheIndex = make(map[string]*list.Element, maxsize)
+	lc.lock = new(sync.RWMutex)
+	for k, v := range values {
+		entry := &lruCacheEntry{key: k, val: v, cost: lc.cost(k, v)}
+		lc.charge(entry.cost)
+		lc.cacheIndex[k] = lc.cacheData.PushFront(entry)
+	}
+	lc.shrink(nil)
+}
+
 // Size return current cache count
 // it's safe for concurrent
 func (lc *lruCache) Size() int {
@@ -64,7 +72,7 @@ func (lc *lruCache) size() int {
 	return len(lc.cacheIndex)
 }
 
-// Cap return cache capacity
+// Cap return cache capacity, if cache is bounded by maxbytes, it's the max bytes
 func (lc *lruCache) Cap() int {
 	// lc.lock.RLock() current it's not need
 	c := lc.cap()
@@ -74,18 +82,23 @@ func (lc *lruCache) Cap() int {
 
 // cap is same as Cap, but don't require read lock
 func (lc *lruCache) cap() int {
+	if lc.bounded() {
+		return int(lc.maxBytes)
+	}
 	return lc.maxSize
 }
 
-// Get return value of the key, if not exist, nil returned
+// Get return value of the key, if not exist, nil returned,
+// it require write lock because of the element will be moved to front
 func (lc *lruCache) Get(key string) (val interface{}) {
-	lc.lock.RLock()
+	lc.lock.Lock()
 	elem, has := lc.cacheIndex[key]
 	if has {
 		val = elem.Value.(*lruCacheEntry).val
 		lc.cacheData.MoveToFront(elem)
 	}
-	lc.lock.RUnlock()
+	lc.lock.Unlock()
+	lc.recordGet(has)
 	return
 }
 
@@ -101,46 +114,155 @@ func (lc *lruCache) Remove(key string) {
 	lc.lock.Lock()
 	elem, has := lc.cacheIndex[key]
 	if has {
-		lc.cacheData.Remove(elem)
-		delete(lc.cacheIndex, key)
+		lc.remove(elem)
 	}
 	lc.lock.Unlock()
+	if has {
+		lc.recordRemove()
+	}
 }
 
 // Set add an key-value to cache, if key already exist in cache, update it's value
 func (lc *lruCache) Set(key string, val interface{}) {
-	lc.set(key, val, true)
+	lc.set(key, val, true, nil)
 }
 
 // Update only update existed key-value, returned value show whether it's successed
 func (lc *lruCache) Update(key string, val interface{}) bool {
-	return lc.set(key, val, false)
+	return lc.set(key, val, false, nil)
 }
 
 // set do actually update cache, the parameter forceSet make a difference when
 // key already exist in cache, if forceSet, update it's value, else do nothing
-// return value show if operation is successed or not
-func (lc *lruCache) set(key string, val interface{}, forceSet bool) (ret bool) {
-	var entry *lruCacheEntry
-	ret = true
+// return value show if operation is successed or not, if forceSet, tags of
+// key are replaced by tags
+func (lc *lruCache) set(key string, val interface{}, forceSet bool, tags []string) (ret bool) {
+	var evicted []evictedEntry
 	lc.lock.Lock()
-	if elem, has := lc.cacheIndex[key]; !has {
-		if !forceSet {
-			ret = false
-		} else if lc.cap() == lc.size() {
-			elem = lc.cacheData.Back() // remove last and reuse entry for new value
-			entry = elem.Value.(*lruCacheEntry)
-			lc.cacheData.Remove(elem)
-			delete(lc.cacheIndex, entry.key)
-		} else {
-			entry = new(lruCacheEntry)
+	if elem, has := lc.cacheIndex[key]; has {
+		entry := elem.Value.(*lruCacheEntry)
+		cost := lc.cost(key, val)
+		lc.charge(cost - entry.cost)
+		entry.val, entry.cost = val, cost
+		lc.cacheData.MoveToFront(elem)
+		ret = true
+	} else if forceSet {
+		if lc.maxSize > 0 && lc.size() == lc.maxSize {
+			evicted = lc.removeOldest(evicted)
 		}
-		entry.init(key, val) // setup value
+		entry := &lruCacheEntry{key: key, val: val, cost: lc.cost(key, val)}
+		lc.charge(entry.cost)
 		lc.cacheIndex[key] = lc.cacheData.PushFront(entry)
-	} else {
-		elem.Value.(*lruCacheEntry).val = val
-		lc.cacheData.MoveToFront(elem)
+		ret = true
+	}
+	if ret {
+		if forceSet {
+			lc.retag(key, tags)
+		}
+		evicted = lc.shrink(evicted)
 	}
 	lc.lock.Unlock()
+	if ret {
+		lc.recordSet()
+	}
+	lc.evictAll(evicted)
 	return
 }
+
+// SetSizer replace the function to measure entries, exist entries are measured
+// again and evicted if cache is over budget
+func (lc *lruCache) SetSizer(sizer Sizer) {
+	lc.lock.Lock()
+	lc.sizer = sizer
+	for elem := lc.cacheData.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*lruCacheEntry)
+		cost := lc.cost(entry.key, entry.val)
+		lc.charge(cost - entry.cost)
+		entry.cost = cost
+	}
+	evicted := lc.shrink(nil)
+	lc.lock.Unlock()
+	lc.evictAll(evicted)
+}
+
+// shrink remove least recently used entries until memory cost is under budget
+func (lc *lruCache) shrink(evicted []evictedEntry) []evictedEntry {
+	for lc.overBudget() {
+		evicted = lc.removeOldest(evicted)
+	}
+	return evicted
+}
+
+// removeOldest remove the least recently used entry and append it to evicted
+func (lc *lruCache) removeOldest(evicted []evictedEntry) []evictedEntry {
+	elem := lc.cacheData.Back()
+	entry := elem.Value.(*lruCacheEntry)
+	lc.remove(elem)
+	return append(evicted, evictedEntry{entry.key, entry.val})
+}
+
+// remove remove an element from list, index and tags
+func (lc *lruCache) remove(elem *list.Element) {
+	entry := lc.cacheData.Remove(elem).(*lruCacheEntry)
+	delete(lc.cacheIndex, entry.key)
+	lc.charge(-entry.cost)
+	lc.untag(entry.key)
+}
+
+// evictAll notify eviction hook of evicted entries, it's called after lock is
+// released
+func (lc *lruCache) evictAll(evicted []evictedEntry) {
+	for _, e := range evicted {
+		lc.evict(e.key, e.val)
+	}
+}
+
+// Dump write all entries to writer, lru order is kept
+func (lc *lruCache) Dump(w io.Writer) error {
+	return dumpEntries(w, lc.entries())
+}
+
+// entries return all entries from least recently used to most recently used
+func (lc *lruCache) entries() []snapshotEntry {
+	lc.lock.RLock()
+	entries := make([]snapshotEntry, 0, lc.size())
+	for elem := lc.cacheData.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*lruCacheEntry)
+		entries = append(entries, snapshotEntry{Key: entry.key, Val: entry.val})
+	}
+	lc.lock.RUnlock()
+	return entries
+}
+
+// Load read entries from reader and add them to cache
+func (lc *lruCache) Load(r io.Reader) error {
+	return loadEntries(r, func(e *snapshotEntry) {
+		lc.Set(e.Key, e.Val)
+	})
+}
+
+// SetWithTags add an key-value to cache, and bind it to tags
+func (lc *lruCache) SetWithTags(key string, val interface{}, tags ...string) {
+	lc.set(key, val, true, tags)
+}
+
+// InvalidateTag remove all keys bind to tag
+func (lc *lruCache) InvalidateTag(tag string) {
+	removeKeys(lc, lc.tagged(tag))
+}
+
+// RemovePrefix remove all keys start with prefix
+func (lc *lruCache) RemovePrefix(prefix string) {
+	removePrefix(lc, lc.keys(), prefix)
+}
+
+// keys return all keys in cache
+func (lc *lruCache) keys() []string {
+	lc.lock.RLock()
+	keys := make([]string, 0, len(lc.cacheIndex))
+	for k := range lc.cacheIndex {
+		keys = append(keys, k)
+	}
+	lc.lock.RUnlock()
+	return keys
+}
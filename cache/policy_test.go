@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/cosiner/gohper/lib/test"
+)
+
+// replay access keys in trace, missing key is set to cache after access,
+// return hit rate of cache
+func replay(typ CacherType, maxsize int, trace []int) float64 {
+	cache, _ := New(typ, "maxsize="+strconv.Itoa(maxsize))
+	for _, k := range trace {
+		key := strconv.Itoa(k)
+		if cache.Get(key) == nil {
+			cache.Set(key, k)
+		}
+	}
+	return cache.Stats().HitRate()
+}
+
+// scanTrace access a hot set repeatly, and interleave with one-time scan of
+// cold keys
+func scanTrace() []int {
+	var trace []int
+	cold := 1000
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 5; i++ {
+			for k := 0; k < 50; k++ {
+				trace = append(trace, k)
+			}
+		}
+		for i := 0; i < 200; i++ {
+			trace = append(trace, cold)
+			cold++
+		}
+	}
+	return trace
+}
+
+// zipfTrace generate keys follow zipf distribution with fixed seed
+func zipfTrace() []int {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, 10000)
+	trace := make([]int, 100000)
+	for i := range trace {
+		trace[i] = int(zipf.Uint64())
+	}
+	return trace
+}
+
+func TestPolicyScan(t *testing.T) {
+	tt := test.Wrap(t)
+	trace := scanTrace()
+	lru, lfu, arc := replay(LRU, 100, trace), replay(LFU, 100, trace), replay(ARC, 100, trace)
+	tt.Logf("scan hit rate: lru %.3f, lfu %.3f, arc %.3f", lru, lfu, arc)
+	tt.True(lfu > lru)
+	tt.True(arc > lru)
+}
+
+func TestPolicyZipf(t *testing.T) {
+	tt := test.Wrap(t)
+	trace := zipfTrace()
+	lru, lfu, arc := replay(LRU, 500, trace), replay(LFU, 500, trace), replay(ARC, 500, trace)
+	tt.Logf("zipf hit rate: lru %.3f, lfu %.3f, arc %.3f", lru, lfu, arc)
+	tt.True(lfu > lru)
+	tt.True(arc > lru)
+}
+
+func TestLFUCache(t *testing.T) {
+	tt := test.Wrap(t)
+	cache, _ := New(LFU, "maxsize=2")
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Get("a")
+	cache.Set("c", 3) // b is least frequently used
+	tt.Eq(nil, cache.Get("b"))
+	tt.Eq(1, cache.Get("a"))
+	tt.Eq(3, cache.Get("c"))
+	cache.Remove("c")
+	tt.Eq(1, cache.Size())
+	cache.Set("d", 4)
+	cache.Set("e", 5) // d is least frequently used
+	tt.False(cache.IsExist("d"))
+	tt.True(cache.Update("e", 6))
+	tt.False(cache.Update("d", 6))
+}
+
+func TestARCCache(t *testing.T) {
+	tt := test.Wrap(t)
+	cache, _ := New(ARC, "maxsize=2")
+	cache.Set("a", 1)
+	cache.Get("a") // a is in T2
+	cache.Set("b", 2)
+	cache.Set("c", 3) // b is eliminated from T1
+	tt.Eq(nil, cache.Get("b"))
+	tt.Eq(1, cache.Get("a"))
+	tt.Eq(2, cache.Size())
+	cache.Set("b", 2) // ghost hit
+	tt.Eq(2, cache.Get("b"))
+	tt.Eq(2, cache.Size())
+	cache.Remove("b")
+	tt.False(cache.IsExist("b"))
+	tt.False(cache.Update("b", 3))
+	for i := 0; i < 100; i++ {
+		cache.Set(strconv.Itoa(i), i)
+		tt.True(cache.Size() <= 2)
+	}
+}
@@ -1,33 +1,48 @@
 package cache
 
 import (
+	"io"
+
 	"github.com/cosiner/gohper/lib/types"
 )
 
+// randCache is a cacher that eliminate entries randomly, it's bounded by entry
+// count or memory cost of entries
 type randCache struct {
+	instrument
+	tagIndex
+	periodicSnapshot
+	sizeBudget
+	costs   map[string]int64 // memory cost of entries, only used when bounded by maxbytes
 	maxSize int
 	*types.LockedValues
 }
 
-func (rc *randCache) Init(config string) (err error) {
-	var maxsize int
-	if maxsize, err = parseMaxSize(config); err == nil {
-		rc.LockedValues = types.NewLockedValues()
-		rc.maxSize = maxsize
-	}
-	return
+func (rc *randCache) Init(config string) error {
+	return rc.InitVals(config, nil)
 }
 
 func (rc *randCache) InitVals(config string, values map[string]interface{}) (err error) {
 	var maxsize int
-	if maxsize, err = parseMaxSize(config); err == nil {
-		fixSize(values, maxsize)
+	if maxsize, rc.maxBytes, err = parseLimits(config); err == nil {
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+		if maxsize > 0 {
+			fixSize(values, maxsize)
+		}
 		rc.LockedValues = types.NewLockedValuesWith(values)
 		rc.maxSize = maxsize
+		rc.costs = make(map[string]int64)
+		for k, v := range values {
+			rc.account(k, v)
+		}
+		rc.shrink("", nil)
 	}
 	return
 }
 
+// Cap return cache capacity, if cache is bounded by maxbytes, it's the max bytes
 func (rc *randCache) Cap() int {
 	// rc.RLock() // currently don't need lock for maxSize will not be modified
 	c := rc.cap()
@@ -36,27 +51,161 @@ func (rc *randCache) Cap() int {
 }
 
 func (rc *randCache) cap() int {
+	if rc.bounded() {
+		return int(rc.maxBytes)
+	}
 	return rc.maxSize
 }
 
 func (rc *randCache) Set(key string, val interface{}) {
-	rc.set(key, val, true)
+	rc.set(key, val, true, nil)
 }
 
 func (rc *randCache) Update(key string, val interface{}) bool {
-	return rc.set(key, val, false)
+	return rc.set(key, val, false, nil)
+}
+
+func (rc *randCache) Get(key string) interface{} {
+	rc.RLock()
+	val, has := rc.Values[key]
+	rc.RUnlock()
+	rc.recordGet(has)
+	return val
+}
+
+func (rc *randCache) Remove(key string) {
+	rc.Lock()
+	has := rc.Values.IsExist(key)
+	rc.remove(key)
+	rc.Unlock()
+	if has {
+		rc.recordRemove()
+	}
 }
 
-func (rc *randCache) set(key string, val interface{}, forceSet bool) (ret bool) {
+// set do actually update cache, if forceSet, key is added if not exist and
+// it's tags are replaced by tags, else only update value of exist key
+func (rc *randCache) set(key string, val interface{}, forceSet bool, tags []string) (ret bool) {
+	var evicted []evictedEntry
 	rc.Lock()
 	values := rc.Values
-	if values.IsExist(key) || forceSet {
-		if values.Size() == rc.cap() {
-			values.RandomRemove()
+	if exist := values.IsExist(key); exist || forceSet {
+		if !exist && rc.maxSize > 0 && values.Size() == rc.maxSize {
+			evicted = rc.removeRandom(key, evicted)
 		}
 		values.Set(key, val)
+		rc.account(key, val)
+		if forceSet {
+			rc.retag(key, tags)
+		}
+		evicted = rc.shrink(key, evicted)
 		ret = true
 	}
 	rc.Unlock()
+	if ret {
+		rc.recordSet()
+	}
+	for _, e := range evicted {
+		rc.evict(e.key, e.val)
+	}
 	return
 }
+
+// SetSizer replace the function to measure entries, exist entries are measured
+// again and evicted if cache is over budget
+func (rc *randCache) SetSizer(sizer Sizer) {
+	rc.Lock()
+	rc.sizer = sizer
+	for k, v := range rc.Values {
+		rc.account(k, v)
+	}
+	evicted := rc.shrink("", nil)
+	rc.Unlock()
+	for _, e := range evicted {
+		rc.evict(e.key, e.val)
+	}
+}
+
+// account measure the cost of an entry and replace it's old cost
+func (rc *randCache) account(key string, val interface{}) {
+	if rc.bounded() {
+		cost := rc.cost(key, val)
+		rc.charge(cost - rc.costs[key])
+		rc.costs[key] = cost
+	}
+}
+
+// remove remove an entry and it's cost
+func (rc *randCache) remove(key string) {
+	rc.Values.Remove(key)
+	rc.untag(key)
+	if cost, has := rc.costs[key]; has {
+		rc.charge(-cost)
+		delete(rc.costs, key)
+	}
+}
+
+// shrink random remove entries until memory cost is under budget, the entry of
+// key is kept unless it's the only one
+func (rc *randCache) shrink(key string, evicted []evictedEntry) []evictedEntry {
+	for rc.overBudget() {
+		evicted = rc.removeRandom(key, evicted)
+	}
+	return evicted
+}
+
+// removeRandom random remove an entry except key unless it's the only one,
+// and append it to evicted
+func (rc *randCache) removeRandom(key string, evicted []evictedEntry) []evictedEntry {
+	for k, v := range rc.Values {
+		if k != key || len(rc.Values) == 1 {
+			rc.remove(k)
+			return append(evicted, evictedEntry{k, v})
+		}
+	}
+	return evicted
+}
+
+// Dump write all entries to writer
+func (rc *randCache) Dump(w io.Writer) error {
+	rc.RLock()
+	entries := make([]snapshotEntry, 0, len(rc.Values))
+	for k, v := range rc.Values {
+		entries = append(entries, snapshotEntry{Key: k, Val: v})
+	}
+	rc.RUnlock()
+	return dumpEntries(w, entries)
+}
+
+// Load read entries from reader and add them to cache
+func (rc *randCache) Load(r io.Reader) error {
+	return loadEntries(r, func(e *snapshotEntry) {
+		rc.Set(e.Key, e.Val)
+	})
+}
+
+// SetWithTags add an key-value to cache, and bind it to tags
+func (rc *randCache) SetWithTags(key string, val interface{}, tags ...string) {
+	rc.set(key, val, true, tags)
+}
+
+// InvalidateTag remove all keys bind to tag
+func (rc *randCache) InvalidateTag(tag string) {
+	removeKeys(rc, rc.tagged(tag))
+}
+
+// RemovePrefix remove all keys start with prefix
+func (rc *randCache) RemovePrefix(prefix string) {
+	removePrefix(rc, rc.keys(), prefix)
+}
+
+// keys return all keys in cache
+func (rc *randCache) keys() []string {
+	rc.RLock()
+	keys := make([]string, 0, len(rc.Values))
+	for k := range rc.Values {
+		keys = append(keys, k)
+	}
+	rc.RUnlock()
+	return keys
+}
@@ -1,28 +1,73 @@
 package cache
 
 import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/cosiner/gohper/config"
 	"github.com/cosiner/gohper/redis"
 )
 
-// RedisCache is only a adapter of redis store
+const (
+	// TAG_PREFIX is the key prefix of redis sets that store keys of tags
+	TAG_PREFIX = "gohper.cache.tag:"
+	// KEY_TAGS_PREFIX is the key prefix of redis sets that store tags of keys
+	KEY_TAGS_PREFIX = "gohper.cache.keytags:"
+)
+
+// _UNTAG_SCRIPT remove key KEYS[1] from redis sets of it's tags, remove the tag
+// set KEYS[2] of key, then execute command ARGV[2:] and return it's replay,
+// ARGV[1] is the tag prefix, all is done in one round trip
+const _UNTAG_SCRIPT = `
+local tags = redis.call('SMEMBERS', KEYS[2])
+for _, t in ipairs(tags) do
+	redis.call('SREM', ARGV[1] .. t, KEYS[1])
+end
+if #tags > 0 then
+	redis.call('DEL', KEYS[2])
+end
+return redis.call(unpack(ARGV, 2))
+`
+
+// globEscaper escape special characters of redis glob-style pattern
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// RedisCache is only a adapter of redis store, if codec is set, values are
+// encoded by codec before store and decoded after fetch, so Get return value of
+// same type as Set, default there is no codec, values are stored as is and raw
+// redis replies are returned, it's compatible with data of other clients
 type RedisCache struct {
+	instrument
 	redisStore *redis.RedisStore
+	codec      Codec
 }
 
-func (rc *RedisCache) Init(config string) error {
-	rs, err := redis.New2(config)
-	if err == nil {
-		rc.redisStore = rs
-	}
-	return err
+// Init init redis cacher, config is the config of redis store, and an
+// optional codec=gob|json|raw to set the codec, default raw, it means no codec
+func (rc *RedisCache) Init(conf string) error {
+	return rc.InitVals(conf, nil)
 }
 
-func (rc *RedisCache) InitVals(config string, values map[string]interface{}) error {
-	rs, err := redis.New2(config)
+func (rc *RedisCache) InitVals(conf string, values map[string]interface{}) error {
+	c := config.NewConfig(config.LINE)
+	c.ParseString(conf)
+	rc.codec = nil
+	if name, has := c.Val("codec"); has && name != "raw" {
+		codec, err := CodecByName(name)
+		if err != nil {
+			return err
+		}
+		rc.codec = codec
+	}
+	rs, err := redis.New2(conf)
 	if err == nil {
 		rc.redisStore = rs
 		for k, v := range values {
-			if err = rs.Set(k, v); err != nil {
+			if v, err = rc.encode(v); err == nil {
+				err = rs.Set(k, v)
+			}
+			if err != nil {
 				break
 			}
 		}
@@ -30,29 +75,99 @@ func (rc *RedisCache) InitVals(config string, values map[string]interface{}) err
 	return err
 }
 
-// Get by key
+// SetCodec set codec of cache, nil means no codec, it should be called before
+// cache is used
+func (rc *RedisCache) SetCodec(codec Codec) {
+	rc.codec = codec
+}
+
+// encode encode value use codec if exist
+func (rc *RedisCache) encode(val interface{}) (interface{}, error) {
+	if rc.codec == nil {
+		return val, nil
+	}
+	return rc.codec.Encode(val)
+}
+
+// Get by key, if codec is set, decoded value is returned
 func (rc *RedisCache) Get(key string) interface{} {
 	v, err := rc.redisStore.Get(key)
+	if err == nil && v != nil && rc.codec != nil {
+		var data []byte
+		if data, err = redis.ToBytes(v, nil); err == nil {
+			v, err = rc.codec.Decode(data)
+		}
+	}
 	if err != nil {
 		v = nil
 	}
+	rc.recordGet(v != nil)
 	return v
 }
 
+// GetInto decode value of key to ptr use codec, if key not exist,
+// redis.ErrNil is returned
+func (rc *RedisCache) GetInto(key string, ptr interface{}) error {
+	if rc.codec == nil {
+		return ErrNoCodec
+	}
+	data, err := redis.ToBytes(rc.redisStore.Get(key))
+	rc.recordGet(err == nil)
+	if err == nil {
+		err = rc.codec.DecodeInto(data, ptr)
+	}
+	return err
+}
+
+// Set bind value to key, key is removed from it's tags
 func (rc *RedisCache) Set(key string, val interface{}) {
-	rc.redisStore.Set(key, val)
+	v, err := rc.encode(val)
+	if err == nil {
+		if _, err = rc.untagDo(context.Background(), key, "SET", key, v); err == nil {
+			rc.recordSet()
+		}
+	}
+}
+
+// SetWithExpire bind an value to key, it will be expired after ttl by redis server,
+// ttl will be round up to seconds, if ttl <= 0, it will never expire, key is
+// removed from it's tags
+func (rc *RedisCache) SetWithExpire(key string, val interface{}, ttl time.Duration) {
+	val, err := rc.encode(val)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	if ttl <= 0 {
+		_, err = rc.untagDo(ctx, key, "SET", key, val)
+	} else {
+		_, err = rc.untagDo(ctx, key, "SETEX", key, int64((ttl+time.Second-1)/time.Second), val)
+	}
+	if err == nil {
+		rc.recordSet()
+	}
 }
 
 func (rc *RedisCache) Update(key string, val interface{}) bool {
+	val, err := rc.encode(val)
+	if err != nil {
+		return false
+	}
 	success, err := rc.redisStore.Modify(key, val)
 	if err != nil {
 		success = false
 	}
+	if success {
+		rc.recordSet()
+	}
 	return success
 }
 
+// Remove remove key and remove it from it's tags
 func (rc *RedisCache) Remove(key string) {
-	rc.redisStore.Remove(key)
+	if n, err := redis.ToInt(rc.untagDo(context.Background(), key, "DEL", key)); err == nil && n > 0 {
+		rc.recordRemove()
+	}
 }
 
 func (rc *RedisCache) IsExist(key string) bool {
@@ -72,6 +187,131 @@ func (rc *RedisCache) Cap() int {
 	return -1
 }
 
+// GetCtx return value of key, if codec is set, decoded value is returned,
+// errors of network and decoding are returned
+func (rc *RedisCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	v, err := rc.redisStore.QueryCtx(ctx, "GET", key)
+	if err == nil && v != nil && rc.codec != nil {
+		var data []byte
+		if data, err = redis.ToBytes(v, nil); err == nil {
+			v, err = rc.codec.Decode(data)
+		}
+	}
+	if err != nil {
+		v = nil
+	}
+	rc.recordGet(v != nil)
+	return v, err
+}
+
+// SetCtx bind value to key, if codec is set, value is encoded first, key is
+// removed from it's tags
+func (rc *RedisCache) SetCtx(ctx context.Context, key string, val interface{}) error {
+	val, err := rc.encode(val)
+	if err == nil {
+		if _, err = rc.untagDo(ctx, key, "SET", key, val); err == nil {
+			rc.recordSet()
+		}
+	}
+	return err
+}
+
+// UpdateCtx only update exist key-value pair use SET XX, it's atomic
+func (rc *RedisCache) UpdateCtx(ctx context.Context, key string, val interface{}) (bool, error) {
+	val, err := rc.encode(val)
+	if err != nil {
+		return false, err
+	}
+	reply, err := rc.redisStore.QueryCtx(ctx, "SET", key, val, "XX")
+	if err != nil || reply == nil { // nil replay means key not exist
+		return false, err
+	}
+	rc.recordSet()
+	return true, nil
+}
+
+// RemoveCtx remove key from redis and remove it from it's tags
+func (rc *RedisCache) RemoveCtx(ctx context.Context, key string) error {
+	n, err := redis.ToInt(rc.untagDo(ctx, key, "DEL", key))
+	if err == nil && n > 0 {
+		rc.recordRemove()
+	}
+	return err
+}
+
+// IsExistCtx check whether key exist in redis
+func (rc *RedisCache) IsExistCtx(ctx context.Context, key string) (bool, error) {
+	return redis.ToBool(rc.redisStore.QueryCtx(ctx, "EXISTS", key))
+}
+
+// SizeCtx return count of keys in current redis database
+func (rc *RedisCache) SizeCtx(ctx context.Context) (int, error) {
+	return redis.ToInt(rc.redisStore.QueryCtx(ctx, "DBSIZE"))
+}
+
+// SetWithTags bind an value to key, and replace tags of key, key is added to
+// redis set of each tag, tags are added to redis set of the key
+func (rc *RedisCache) SetWithTags(key string, val interface{}, tags ...string) {
+	rc.Set(key, val)
+	if len(tags) == 0 {
+		return
+	}
+	args := make([]interface{}, 0, len(tags)+1)
+	args = append(args, KEY_TAGS_PREFIX+key)
+	for _, t := range tags {
+		rc.redisStore.Update("SADD", TAG_PREFIX+t, key)
+		args = append(args, t)
+	}
+	rc.redisStore.Update("SADD", args...)
+}
+
+// untagDo remove key from redis sets of it's tags and remove tag set of key,
+// then execute the command, it's atomic and take only one round trip
+func (rc *RedisCache) untagDo(ctx context.Context, key, cmd string, args ...interface{}) (interface{}, error) {
+	params := make([]interface{}, 0, len(args)+6)
+	params = append(params, _UNTAG_SCRIPT, 2, key, KEY_TAGS_PREFIX+key, TAG_PREFIX, cmd)
+	return rc.redisStore.QueryCtx(ctx, "EVAL", append(params, args...)...)
+}
+
+// InvalidateTag remove all keys in redis set of tag and the set itself, keys
+// are also removed from their other tags
+func (rc *RedisCache) InvalidateTag(tag string) {
+	tagKey := TAG_PREFIX + tag
+	keys, err := redis.ToStrings(rc.redisStore.Query("SMEMBERS", tagKey))
+	if err != nil || len(keys) == 0 {
+		return
+	}
+	ctx := context.Background()
+	for _, k := range keys {
+		if n, err := redis.ToInt(rc.untagDo(ctx, k, "DEL", k)); err == nil && n > 0 {
+			rc.recordRemove()
+		}
+	}
+	rc.redisStore.Update("DEL", tagKey)
+}
+
+// RemovePrefix remove all keys start with prefix use SCAN
+func (rc *RedisCache) RemovePrefix(prefix string) {
+	pattern := globEscaper.Replace(prefix) + "*"
+	cursor := "0"
+	for {
+		reply, err := redis.ToValues(rc.redisStore.Query("SCAN", cursor, "MATCH", pattern, "COUNT", 100))
+		if err != nil || len(reply) != 2 {
+			return
+		}
+		if cursor, err = redis.ToString(reply[0], nil); err != nil {
+			return
+		}
+		keys, _ := redis.ToStrings(reply[1], nil)
+		for _, k := range keys {
+			rc.Remove(k)
+		}
+		if cursor == "0" {
+			return
+		}
+	}
+}
+
 // RealStore return the real redis store to do any other operation such as destroy
 func (rc *RedisCache) RealStore() *redis.RedisStore {
 	return rc.redisStore
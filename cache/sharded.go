@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"io"
+)
+
+const (
+	// DEF_SHARDS is the default segment count of sharded lru cache
+	DEF_SHARDS = 16
+)
+
+// shardedLRUCache is a lru cacher that hash keys into independently locked
+// lru segments, it reduce lock contention under parallel access, the
+// elimination is only performed inside a segment
+type shardedLRUCache struct {
+	periodicSnapshot
+	shards []*lruCache
+}
+
+// Init init sharded lru cacher, config format like maxsize=100000&shards=64
+func (sc *shardedLRUCache) Init(config string) error {
+	return sc.InitVals(config, nil)
+}
+
+// InitVals init sharded lru cacher with initial values
+func (sc *shardedLRUCache) InitVals(config string, values map[string]interface{}) (err error) {
+	var maxsize, shards int
+	if maxsize, err = parseMaxSize(config); err != nil {
+		return
+	}
+	if shards, err = parsePositiveInt(config, "shards", DEF_SHARDS); err != nil {
+		return
+	}
+	if shards > maxsize {
+		shards = maxsize
+	}
+	shardVals := make([]map[string]interface{}, shards)
+	for k, v := range values {
+		i := shardIndex(k, shards)
+		if shardVals[i] == nil {
+			shardVals[i] = make(map[string]interface{})
+		}
+		shardVals[i][k] = v
+	}
+	sc.shards = make([]*lruCache, shards)
+	for i := range sc.shards {
+		size := maxsize / shards // spread the remainder to first segments
+		if i < maxsize%shards {
+			size++
+		}
+		sc.shards[i] = new(lruCache)
+		sc.shards[i].init(size, shardVals[i])
+	}
+	return
+}
+
+// shardIndex hash key use FNV-1a and return it's segment index
+func shardIndex(key string, shards int) int {
+	var h uint32 = 2166136261
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % uint32(shards))
+}
+
+// shard return the segment of key
+func (sc *shardedLRUCache) shard(key string) *lruCache {
+	return sc.shards[shardIndex(key, len(sc.shards))]
+}
+
+// Get return value of the key, if not exist, nil returned
+func (sc *shardedLRUCache) Get(key string) interface{} {
+	return sc.shard(key).Get(key)
+}
+
+// Set add an key-value to cache, if key already exist in cache, update it's value
+func (sc *shardedLRUCache) Set(key string, val interface{}) {
+	sc.shard(key).Set(key, val)
+}
+
+// Update only update existed key-value, returned value show whether it's successed
+func (sc *shardedLRUCache) Update(key string, val interface{}) bool {
+	return sc.shard(key).Update(key, val)
+}
+
+// Remove remove key and it's value from cache
+func (sc *shardedLRUCache) Remove(key string) {
+	sc.shard(key).Remove(key)
+}
+
+// IsExist check whether key exist
+func (sc *shardedLRUCache) IsExist(key string) bool {
+	return sc.shard(key).IsExist(key)
+}
+
+// Size return current cache count of all segments
+func (sc *shardedLRUCache) Size() (size int) {
+	for _, s := range sc.shards {
+		size += s.Size()
+	}
+	return
+}
+
+// Cap return cache capacity of all segments
+func (sc *shardedLRUCache) Cap() (c int) {
+	for _, s := range sc.shards {
+		c += s.Cap()
+	}
+	return
+}
+
+// Stats return statistics summed from all segments
+func (sc *shardedLRUCache) Stats() (stats Stats) {
+	for _, s := range sc.shards {
+		ss := s.Stats()
+		stats.Hits += ss.Hits
+		stats.Misses += ss.Misses
+		stats.Evictions += ss.Evictions
+		stats.Sets += ss.Sets
+		stats.Removals += ss.Removals
+	}
+	return
+}
+
+// SetEvictHook set hook of eviction for all segments
+func (sc *shardedLRUCache) SetEvictHook(hook EvictHook) {
+	for _, s := range sc.shards {
+		s.SetEvictHook(hook)
+	}
+}
+
+// Dump write all entries of all segments to writer, lru order in each segment
+// is kept
+func (sc *shardedLRUCache) Dump(w io.Writer) error {
+	var entries []snapshotEntry
+	for _, s := range sc.shards {
+		entries = append(entries, s.entries()...)
+	}
+	return dumpEntries(w, entries)
+}
+
+// Load read entries from reader and add them to cache
+func (sc *shardedLRUCache) Load(r io.Reader) error {
+	return loadEntries(r, func(e *snapshotEntry) {
+		sc.Set(e.Key, e.Val)
+	})
+}
+
+// SetWithTags add an key-value to cache, and bind it to tags
+func (sc *shardedLRUCache) SetWithTags(key string, val interface{}, tags ...string) {
+	sc.shard(key).SetWithTags(key, val, tags...)
+}
+
+// InvalidateTag remove all keys bind to tag from all segments
+func (sc *shardedLRUCache) InvalidateTag(tag string) {
+	for _, s := range sc.shards {
+		s.InvalidateTag(tag)
+	}
+}
+
+// RemovePrefix remove all keys start with prefix from all segments
+func (sc *shardedLRUCache) RemovePrefix(prefix string) {
+	for _, s := range sc.shards {
+		s.RemovePrefix(prefix)
+	}
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/cosiner/gohper/lib/test"
+)
+
+func TestShardedLRUCache(t *testing.T) {
+	tt := test.Wrap(t)
+	cache, err := New(SHARDED_LRU, "maxsize=10&shards=4")
+	tt.Nil(err)
+	tt.Eq(10, cache.Cap())
+	for i := 0; i < 100; i++ {
+		k := strconv.Itoa(i)
+		cache.Set(k, i)
+		tt.Eq(i, cache.Get(k))
+	}
+	tt.True(cache.Size() <= 10)
+	tt.Eq(uint64(100), cache.Stats().Hits)
+	tt.Eq(uint64(100-cache.Size()), cache.Stats().Evictions)
+
+	cache.Set("a", 1)
+	tt.True(cache.Update("a", 2))
+	tt.Eq(2, cache.Get("a"))
+	cache.Remove("a")
+	tt.False(cache.IsExist("a"))
+
+	cache, _ = New(SHARDED_LRU, "maxsize=2&shards=64")
+	tt.Eq(2, cache.Cap())
+	_, err = New(SHARDED_LRU, "maxsize=2&shards=0")
+	tt.Eq(ErrWrongFormat, err)
+}
+
+func TestShardedLRUCacheConcurrent(t *testing.T) {
+	cache, _ := New(SHARDED_LRU, "maxsize=100&shards=8")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				k := strconv.Itoa((n * j) % 200)
+				cache.Set(k, j)
+				cache.Get(k)
+			}
+		}(i)
+	}
+	wg.Wait()
+	test.True(t, cache.Size() <= 100)
+}
+
+func benchmarkParallel(b *testing.B, typ CacherType, config string) {
+	cache, _ := New(typ, config)
+	keys := make([]string, 1<<16)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		cache.Set(keys[i], i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			k := keys[(i*7919)&(len(keys)-1)]
+			if i%10 == 0 {
+				cache.Set(k, i)
+			} else {
+				cache.Get(k)
+			}
+		}
+	})
+}
+
+func BenchmarkLRUParallel(b *testing.B) {
+	benchmarkParallel(b, LRU, "maxsize=100000")
+}
+
+func BenchmarkShardedLRUParallel(b *testing.B) {
+	benchmarkParallel(b, SHARDED_LRU, "maxsize=100000&shards=64")
+}
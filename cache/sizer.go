@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"reflect"
+	"sync/atomic"
+
+	"github.com/cosiner/gohper/config"
+	"github.com/cosiner/gohper/lib/types"
+)
+
+// Sizer measure the memory cost of an entry in bytes
+type Sizer func(key string, val interface{}) int64
+
+// SizeBounded is implemented by cachers that can be bounded by memory use
+// config maxbytes=256M instead of maxsize, entries are evicted until the
+// cost of all entries is back under the budget
+type SizeBounded interface {
+	// SetSizer replace the function to measure entries, cost of exist entries
+	// are measured again
+	SetSizer(sizer Sizer)
+	// Bytes return cost of all entries, it's always 0 if cache is not bounded
+	// by maxbytes
+	Bytes() int64
+}
+
+// DefaultSizer estimate memory of key and value by walk the value use reflect,
+// memory shared by multiple references is only counted once
+func DefaultSizer(key string, val interface{}) int64 {
+	return int64(len(key)) + sizeOf(reflect.ValueOf(val), make(map[uintptr]bool))
+}
+
+// sizeOf return memory of value itself and memory referenced by it
+func sizeOf(v reflect.Value, seen map[uintptr]bool) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	size := int64(v.Type().Size())
+	switch v.Kind() {
+	case reflect.String:
+		size += int64(v.Len())
+	case reflect.Ptr, reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			break
+		}
+		seen[v.Pointer()] = true
+		if v.Kind() == reflect.Ptr {
+			size += sizeOf(v.Elem(), seen)
+		} else {
+			for i := 0; i < v.Len(); i++ {
+				size += sizeOf(v.Index(i), seen)
+			}
+		}
+	case reflect.Interface:
+		size += sizeOf(v.Elem(), seen)
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			break
+		}
+		seen[v.Pointer()] = true
+		for _, k := range v.MapKeys() {
+			size += sizeOf(k, seen) + sizeOf(v.MapIndex(k), seen)
+		}
+	case reflect.Array: // elements are stored inline, only count referenced memory
+		for i := 0; i < v.Len(); i++ {
+			size += referenced(v.Index(i), seen)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			size += referenced(v.Field(i), seen)
+		}
+	}
+	return size
+}
+
+// referenced return memory referenced by value, not include value itself
+func referenced(v reflect.Value, seen map[uintptr]bool) int64 {
+	return sizeOf(v, seen) - int64(v.Type().Size())
+}
+
+// sizeBudget account memory cost of entries for cachers bounded by maxbytes,
+// all methods except Bytes should be called with the cacher's lock held
+type sizeBudget struct {
+	maxBytes int64
+	bytes    int64 // accessed atomically
+	sizer    Sizer
+}
+
+// Bytes return cost of all entries
+func (sb *sizeBudget) Bytes() int64 {
+	return atomic.LoadInt64(&sb.bytes)
+}
+
+// bounded check whether cache is bounded by maxbytes
+func (sb *sizeBudget) bounded() bool {
+	return sb.maxBytes > 0
+}
+
+// cost return memory cost of an entry, 0 if cache is not bounded
+func (sb *sizeBudget) cost(key string, val interface{}) int64 {
+	if !sb.bounded() {
+		return 0
+	}
+	if sb.sizer != nil {
+		return sb.sizer(key, val)
+	}
+	return DefaultSizer(key, val)
+}
+
+// charge add n bytes to used memory, n may be negative
+func (sb *sizeBudget) charge(n int64) {
+	atomic.AddInt64(&sb.bytes, n)
+}
+
+// overBudget check whether used memory is over budget
+func (sb *sizeBudget) overBudget() bool {
+	return sb.bounded() && sb.bytes > sb.maxBytes
+}
+
+// evictedEntry is an entry removed when cache is full, it's passed to
+// eviction hook after lock is released
+type evictedEntry struct {
+	key string
+	val interface{}
+}
+
+// parseLimits parse maxsize or maxbytes from config string, only one of them
+// is allowed, maxbytes is parsed by types.Str2Bytes, like 256M
+func parseLimits(conf string) (maxsize int, maxbytes int64, err error) {
+	c := config.NewConfig(config.LINE)
+	c.ParseString(conf)
+	s, has := c.Val("maxbytes")
+	if !has {
+		maxsize, err = parseMaxSize(conf)
+		return
+	}
+	if _, has = c.Val("maxsize"); has {
+		return 0, 0, ErrWrongFormat
+	}
+	n, err := types.Str2Bytes(s)
+	if err != nil || n == 0 {
+		return 0, 0, ErrWrongFormat
+	}
+	return 0, int64(n), nil
+}
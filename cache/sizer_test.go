@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/cosiner/gohper/lib/test"
+)
+
+func lenSizer(key string, val interface{}) int64 {
+	return int64(len(val.(string)))
+}
+
+func TestMaxBytes(t *testing.T) {
+	tt := test.Wrap(t)
+	for _, typ := range []CacherType{LRU, RANDOM} {
+		c, err := New(typ, "maxbytes=1K")
+		tt.Nil(err)
+		tt.Eq(1024, c.Cap())
+		sb := c.(SizeBounded)
+		sb.SetSizer(lenSizer)
+
+		var evicted int
+		c.(EvictNotifier).SetEvictHook(EvictHookFunc(func(string, interface{}) {
+			evicted++
+		}))
+		c.Set("a", string(make([]byte, 500)))
+		c.Set("b", string(make([]byte, 500)))
+		tt.Eq(int64(1000), sb.Bytes())
+		c.Set("c", string(make([]byte, 100)))
+		tt.Eq(2, c.Size())
+		tt.Eq(1, evicted)
+		tt.True(c.IsExist("c"))
+		tt.Eq(int64(600), sb.Bytes())
+
+		c.Set("c", string(make([]byte, 1000))) // update is also accounted
+		tt.Eq(1, c.Size())
+		tt.Eq(int64(1000), sb.Bytes())
+
+		c.Remove("c")
+		tt.Eq(int64(0), sb.Bytes())
+
+		c.Set("d", string(make([]byte, 2000))) // too large to be cached
+		tt.False(c.IsExist("d"))
+		tt.Eq(int64(0), sb.Bytes())
+	}
+
+	c, _ := New(LRU, "maxbytes=1K")
+	for _, k := range []string{"a", "b", "c"} {
+		c.Set(k, "abc")
+	}
+	c.Get("a")
+	c.(SizeBounded).SetSizer(func(string, interface{}) int64 {
+		return 400
+	})
+	tt.True(c.IsExist("a"))
+	tt.False(c.IsExist("b"))
+	tt.True(c.IsExist("c"))
+	tt.Eq(int64(800), c.(SizeBounded).Bytes())
+
+	c, _ = New(LRU, "maxsize=10")
+	c.Set("a", "abc")
+	tt.Eq(int64(0), c.(SizeBounded).Bytes())
+
+	_, err := New(LRU, "maxbytes=1K&maxsize=10")
+	tt.Eq(ErrWrongFormat, err)
+	_, err = New(RANDOM, "maxbytes=abc")
+	tt.Eq(ErrWrongFormat, err)
+	_, err = New(RANDOM, "maxbytes=")
+	tt.Eq(ErrWrongFormat, err)
+}
+
+func TestDefaultSizer(t *testing.T) {
+	type user struct {
+		Name string
+		Tags []string
+		next *user
+	}
+	u := &user{Name: "abcd", Tags: []string{"ab"}}
+	u.next = u
+	size := DefaultSizer("key", u)
+	tt := test.Wrap(t)
+	tt.True(size > int64(len("key")+len("abcd")+len("ab")))
+	tt.Eq(size, DefaultSizer("key", u)) // cycle is only counted once
+	tt.Eq(int64(3+16+5), DefaultSizer("key", "hello"))
+}
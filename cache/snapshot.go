@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cosiner/gohper/config"
+	"github.com/cosiner/gohper/lib/encoding"
+	"github.com/cosiner/gohper/lib/sys"
+)
+
+const (
+	// DEF_SNAPSHOT_INTERVAL is the default interval of periodic snapshot
+	DEF_SNAPSHOT_INTERVAL = 5 * time.Minute
+)
+
+// Snapshotter is implemented by in-memory cachers to save and restore
+// all entries, values are encoded use gob, so non-builtin types must be
+// registered by RegisterType
+type Snapshotter interface {
+	// Dump write all entries to writer
+	Dump(w io.Writer) error
+	// Load read entries from reader and add them to cache, exist keys are replaced
+	Load(r io.Reader) error
+	// StopSnapshot stop the periodic snapshot started by snapshot config of New
+	// and do the final dump, if there is none, it does nothing
+	StopSnapshot() error
+}
+
+// periodicSnapshot hold stop function of periodic snapshot started by config,
+// it's embedded in in-memory cachers
+type periodicSnapshot struct {
+	snapshotLock sync.Mutex
+	stopSnapshot func() error
+}
+
+// setSnapshotStop save stop function of periodic snapshot
+func (p *periodicSnapshot) setSnapshotStop(stop func() error) {
+	p.snapshotLock.Lock()
+	p.stopSnapshot = stop
+	p.snapshotLock.Unlock()
+}
+
+// StopSnapshot stop periodic snapshot started by config and do the final dump
+func (p *periodicSnapshot) StopSnapshot() error {
+	p.snapshotLock.Lock()
+	stop := p.stopSnapshot
+	p.stopSnapshot = nil
+	p.snapshotLock.Unlock()
+	if stop == nil {
+		return nil
+	}
+	return stop()
+}
+
+// snapshotEntry is a entry in snapshot
+type snapshotEntry struct {
+	Key  string
+	Val  interface{}
+	TTL  time.Duration // remaining time to live, 0 means never expire
+	Freq int           // access frequency, for lfu it's frequency, for arc, >1 means frequently used
+}
+
+// snapshot is all entries of a cache, for ordered cacher, entries is from
+// least recently used to most recently used
+type snapshot struct {
+	Entries []snapshotEntry
+}
+
+// dumpEntries write entries to writer
+func dumpEntries(w io.Writer, entries []snapshotEntry) error {
+	return encoding.WriteGOB(w, &snapshot{entries})
+}
+
+// loadEntries read entries from reader and restore each of them
+func loadEntries(r io.Reader, restore func(*snapshotEntry)) error {
+	var s snapshot
+	err := encoding.ReadGOB(r, &s)
+	if err == nil {
+		for i := range s.Entries {
+			restore(&s.Entries[i])
+		}
+	}
+	return err
+}
+
+// DumpFile dump cache to file, it's first written to a unique temporary file
+// in the same directory, then renamed to the file
+func DumpFile(s Snapshotter, path string) error {
+	path = sys.ExpandHome(path)
+	fd, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = s.Dump(fd)
+	if e := fd.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(fd.Name(), path)
+	}
+	if err != nil {
+		os.Remove(fd.Name())
+	}
+	return err
+}
+
+// LoadFile load cache from file
+func LoadFile(s Snapshotter, path string) error {
+	return sys.OpenForRead(path, func(fd *os.File) error {
+		return s.Load(fd)
+	})
+}
+
+// StartSnapshot load cache from file if it exist, then dump cache to file
+// every interval, the returned stop function stop it and do the last dump
+func StartSnapshot(s Snapshotter, path string, interval time.Duration) (stop func() error, err error) {
+	path = sys.ExpandHome(path)
+	if sys.IsFile(path) {
+		if err = LoadFile(s, path); err != nil {
+			return
+		}
+	}
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				DumpFile(s, path)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() error {
+		close(done)
+		<-exited // wait dumping in progress, it must not overwrite the final one
+		return DumpFile(s, path)
+	}, nil
+}
+
+// startConfigSnapshot start periodic snapshot if there is snapshot=path in
+// config, snapshot.interval is the interval, default DEF_SNAPSHOT_INTERVAL,
+// it's stopped by StopSnapshot of the cache
+func startConfigSnapshot(cache Cache, conf string) error {
+	s, is := cache.(Snapshotter)
+	if !is {
+		return nil
+	}
+	c := config.NewConfig(config.LINE)
+	c.ParseString(conf)
+	path, has := c.Val("snapshot")
+	if !has {
+		return nil
+	}
+	interval := DEF_SNAPSHOT_INTERVAL
+	if v, has := c.Val("snapshot.interval"); has {
+		var err error
+		if interval, err = time.ParseDuration(v); err != nil || interval <= 0 {
+			return ErrWrongFormat
+		}
+	}
+	stop, err := StartSnapshot(s, path, interval)
+	if err == nil {
+		if p, is := cache.(interface {
+			setSnapshotStop(func() error)
+		}); is {
+			p.setSnapshotStop(stop)
+		}
+	}
+	return err
+}
+
+// remainingTTL return remaining time to live of an expiration unix nano time
+func remainingTTL(expire, now int64) time.Duration {
+	if expire == 0 {
+		return 0
+	}
+	return time.Duration(expire - now)
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cosiner/gohper/lib/test"
+)
+
+func TestSnapshotLRU(t *testing.T) {
+	tt := test.Wrap(t)
+	for _, typ := range []CacherType{LRU, SHARDED_LRU, ARC} {
+		c, _ := New(typ, "maxsize=3&shards=1")
+		c.Set("a", 1)
+		c.Set("b", "2")
+		c.Set("c", 3.0)
+		c.Get("a") // b is least recently used
+
+		buf := bytes.NewBuffer(nil)
+		tt.Nil(c.(Snapshotter).Dump(buf))
+		c2, _ := New(typ, "maxsize=3&shards=1")
+		tt.Nil(c2.(Snapshotter).Load(buf))
+		tt.Eq(3, c2.Size())
+		c2.Set("d", 4)
+		tt.False(c2.IsExist("b"))
+		tt.Eq(1, c2.Get("a"))
+		tt.Eq(3.0, c2.Get("c"))
+	}
+}
+
+func TestSnapshotLFU(t *testing.T) {
+	tt := test.Wrap(t)
+	c, _ := New(LFU, "maxsize=2")
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Get("a")
+	buf := bytes.NewBuffer(nil)
+	tt.Nil(c.(Snapshotter).Dump(buf))
+
+	c, _ = New(LFU, "maxsize=2")
+	tt.Nil(c.(Snapshotter).Load(buf))
+	c.Get("b")
+	c.Set("c", 3) // a's frequency is restored, b is eliminated
+	tt.True(c.IsExist("a"))
+	tt.False(c.IsExist("b"))
+}
+
+func TestSnapshotExpire(t *testing.T) {
+	tt := test.Wrap(t)
+	c, _ := New(EXPIRE, "interval=1h")
+	defer c.(ExpireCache).Destroy()
+	ec := c.(ExpireCache)
+	ec.SetWithExpire("a", 1, 50*time.Millisecond)
+	ec.SetWithExpire("b", 2, 0)
+	ec.SetWithExpire("c", 3, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	buf := bytes.NewBuffer(nil)
+	tt.Nil(c.(Snapshotter).Dump(buf))
+
+	c2, _ := New(EXPIRE, "interval=1h")
+	defer c2.(ExpireCache).Destroy()
+	tt.Nil(c2.(Snapshotter).Load(buf))
+	tt.Eq(2, c2.Size())
+	tt.Eq(1, c2.Get("a"))
+	time.Sleep(60 * time.Millisecond)
+	tt.Eq(nil, c2.Get("a"))
+	tt.Eq(2, c2.Get("b"))
+}
+
+func TestSnapshotFile(t *testing.T) {
+	tt := test.Wrap(t)
+	dir, _ := os.MkdirTemp("", "cache")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.snapshot")
+
+	c, err := New(RANDOM, "maxsize=10&snapshot="+path+"&snapshot.interval=10ms")
+	tt.Nil(err)
+	c.Set("a", "a")
+	time.Sleep(50 * time.Millisecond)
+	c.Set("b", "b")
+	tt.Nil(c.(Snapshotter).StopSnapshot()) // final dump
+	tt.Nil(c.(Snapshotter).StopSnapshot())
+
+	c2, err := New(RANDOM, "maxsize=10&snapshot="+path)
+	tt.Nil(err)
+	tt.Eq("a", c2.Get("a")) // warm start
+	tt.Eq("b", c2.Get("b"))
+	tt.Nil(c2.(Snapshotter).StopSnapshot())
+
+	stop, err := StartSnapshot(c2.(Snapshotter), path, time.Hour)
+	tt.Nil(err)
+	c2.Set("c", "c")
+	tt.Nil(stop())
+	c3, _ := New(RANDOM, "maxsize=10")
+	tt.Nil(LoadFile(c3.(Snapshotter), path))
+	tt.Eq("c", c3.Get("c"))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tt.Nil(DumpFile(c3.(Snapshotter), path))
+		}()
+	}
+	wg.Wait()
+	tmps, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	tt.Eq(0, len(tmps))
+
+	_, err = New(RANDOM, "maxsize=10&snapshot="+path+"&snapshot.interval=a")
+	tt.Eq(ErrWrongFormat, err)
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is the statistics of a cache
+type Stats struct {
+	Hits      uint64 // count of Get that found the key
+	Misses    uint64 // count of Get that not found the key
+	Evictions uint64 // count of entries eliminated by capacity limit or expiration
+	Sets      uint64 // count of successful Set and Update
+	Removals  uint64 // count of entries removed by Remove
+
+	Loads         uint64        // count of loader calls, only for Loading
+	LoadErrors    uint64        // count of loader calls that returned error
+	TotalLoadTime time.Duration // total time spent in loader calls
+}
+
+// HitRate return the ratio of hits to all Get requests
+func (s Stats) HitRate() float64 {
+	if total := s.Hits + s.Misses; total != 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// AverageLoadTime return the average time spent in loader calls
+func (s Stats) AverageLoadTime() time.Duration {
+	if s.Loads != 0 {
+		return s.TotalLoadTime / time.Duration(s.Loads)
+	}
+	return 0
+}
+
+// EvictHook is called when an entry is eliminated from cache by capacity limit
+// or expiration, it's called after the cache lock is released
+type EvictHook interface {
+	OnEvict(key string, val interface{})
+}
+
+// EvictHookFunc is a function adapter of EvictHook
+type EvictHookFunc func(key string, val interface{})
+
+// OnEvict call the function itself
+func (fn EvictHookFunc) OnEvict(key string, val interface{}) {
+	fn(key, val)
+}
+
+// EvictNotifier is implemented by in-memory cachers to notify eviction
+type EvictNotifier interface {
+	// SetEvictHook set hook of eviction, it should be called before cache is used
+	SetEvictHook(hook EvictHook)
+}
+
+// instrument collect statistics of a cache and notify eviction,
+// all counters is updated atomically
+type instrument struct {
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	sets      uint64
+	removals  uint64
+	loads     uint64
+	loadErrs  uint64
+	loadTime  int64
+	hook      EvictHook
+}
+
+// Stats return statistics of cache
+func (in *instrument) Stats() Stats {
+	return Stats{
+		Hits:          atomic.LoadUint64(&in.hits),
+		Misses:        atomic.LoadUint64(&in.misses),
+		Evictions:     atomic.LoadUint64(&in.evictions),
+		Sets:          atomic.LoadUint64(&in.sets),
+		Removals:      atomic.LoadUint64(&in.removals),
+		Loads:         atomic.LoadUint64(&in.loads),
+		LoadErrors:    atomic.LoadUint64(&in.loadErrs),
+		TotalLoadTime: time.Duration(atomic.LoadInt64(&in.loadTime)),
+	}
+}
+
+// SetEvictHook set hook of eviction
+func (in *instrument) SetEvictHook(hook EvictHook) {
+	in.hook = hook
+}
+
+// recordGet record a Get request, hit is whether the key is found
+func (in *instrument) recordGet(hit bool) {
+	if hit {
+		atomic.AddUint64(&in.hits, 1)
+	} else {
+		atomic.AddUint64(&in.misses, 1)
+	}
+}
+
+// recordSet record a successful Set or Update
+func (in *instrument) recordSet() {
+	atomic.AddUint64(&in.sets, 1)
+}
+
+// recordRemove record a removal
+func (in *instrument) recordRemove() {
+	atomic.AddUint64(&in.removals, 1)
+}
+
+// recordLoad record a loader call
+func (in *instrument) recordLoad(d time.Duration, err error) {
+	atomic.AddUint64(&in.loads, 1)
+	atomic.AddInt64(&in.loadTime, int64(d))
+	if err != nil {
+		atomic.AddUint64(&in.loadErrs, 1)
+	}
+}
+
+// evict record an eviction and call the hook, cache lock must not be held
+func (in *instrument) evict(key string, val interface{}) {
+	atomic.AddUint64(&in.evictions, 1)
+	if in.hook != nil {
+		in.hook.OnEvict(key, val)
+	}
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+)
+
+// Invalidator is implemented by cachers that support bulk invalidation, Set of
+// an exist key remove it's tags, Update keep them
+type Invalidator interface {
+	// SetWithTags add an key-value to cache, and replace it's tags by tags
+	SetWithTags(key string, val interface{}, tags ...string)
+	// InvalidateTag remove all keys bind to tag
+	InvalidateTag(tag string)
+	// RemovePrefix remove all keys start with prefix
+	RemovePrefix(prefix string)
+}
+
+// tagIndex record the relationship of tags and keys, it's safe for concurrent,
+// cachers call it under their own lock when key is set, removed or evicted,
+// so tags always match the keys in cache
+type tagIndex struct {
+	tagLock sync.Mutex
+	tagKeys map[string]map[string]struct{} // tag to keys
+	keyTags map[string][]string            // key to tags
+}
+
+// tag bind key to tags
+func (ti *tagIndex) tag(key string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	ti.tagLock.Lock()
+	if ti.tagKeys == nil {
+		ti.tagKeys = make(map[string]map[string]struct{})
+		ti.keyTags = make(map[string][]string)
+	}
+	for _, t := range tags {
+		keys := ti.tagKeys[t]
+		if keys == nil {
+			keys = make(map[string]struct{})
+			ti.tagKeys[t] = keys
+		}
+		if _, has := keys[key]; !has {
+			keys[key] = struct{}{}
+			ti.keyTags[key] = append(ti.keyTags[key], t)
+		}
+	}
+	ti.tagLock.Unlock()
+}
+
+// retag replace tags of key, it's called when key is set
+func (ti *tagIndex) retag(key string, tags []string) {
+	ti.untag(key)
+	ti.tag(key, tags)
+}
+
+// untag remove key from all tags, it's called when key is removed or evicted
+func (ti *tagIndex) untag(key string) {
+	ti.tagLock.Lock()
+	for _, t := range ti.keyTags[key] {
+		keys := ti.tagKeys[t]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(ti.tagKeys, t)
+		}
+	}
+	delete(ti.keyTags, key)
+	ti.tagLock.Unlock()
+}
+
+// tagged return all keys bind to tag
+func (ti *tagIndex) tagged(tag string) []string {
+	ti.tagLock.Lock()
+	keys := make([]string, 0, len(ti.tagKeys[tag]))
+	for k := range ti.tagKeys[tag] {
+		keys = append(keys, k)
+	}
+	ti.tagLock.Unlock()
+	return keys
+}
+
+// removeKeys remove keys from cache
+func removeKeys(c Cache, keys []string) {
+	for _, k := range keys {
+		c.Remove(k)
+	}
+}
+
+// removePrefix remove keys start with prefix from cache
+func removePrefix(c Cache, keys []string, prefix string) {
+	for _, k := range keys {
+		if strings.HasPrefix(k, prefix) {
+			c.Remove(k)
+		}
+	}
+}
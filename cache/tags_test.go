@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cosiner/gohper/lib/test"
+)
+
+func testInvalidator(tt test.Test, c Cache) {
+	inv := c.(Invalidator)
+	inv.SetWithTags("user:1", 1, "user", "db")
+	inv.SetWithTags("user:2", 2, "user")
+	inv.SetWithTags("post:1", 3, "post", "db")
+	c.Set("post:*", 4)
+
+	inv.InvalidateTag("user")
+	tt.False(c.IsExist("user:1"))
+	tt.False(c.IsExist("user:2"))
+	tt.True(c.IsExist("post:1"))
+
+	inv.InvalidateTag("db")
+	tt.False(c.IsExist("post:1"))
+	tt.True(c.IsExist("post:*"))
+
+	c.Set("user:1", 5) // old tags are removed with the key
+	inv.InvalidateTag("user")
+	tt.True(c.IsExist("user:1"))
+
+	c.Set("post:2", 6)
+	c.Set("postx", 7)
+	inv.RemovePrefix("post:")
+	tt.False(c.IsExist("post:*"))
+	tt.False(c.IsExist("post:2"))
+	tt.True(c.IsExist("postx"))
+	tt.True(c.IsExist("user:1"))
+
+	inv.SetWithTags("k", 1, "users")
+	c.Set("k", 2) // overwrite remove tags
+	inv.SetWithTags("k", 3, "orders")
+	inv.InvalidateTag("users")
+	tt.True(c.IsExist("k"))
+	inv.InvalidateTag("orders")
+	tt.False(c.IsExist("k"))
+}
+
+func TestInvalidator(t *testing.T) {
+	tt := test.Wrap(t)
+	for _, typ := range []CacherType{RANDOM, LRU, SHARDED_LRU, LFU, ARC, EXPIRE} {
+		c, err := New(typ, "maxsize=10")
+		tt.Nil(err)
+		testInvalidator(tt, c)
+		if d, is := c.(Destroyer); is {
+			d.Destroy()
+		}
+	}
+
+	c, _ := New(LRU, "maxsize=1")
+	c.(Invalidator).SetWithTags("a", 1, "t")
+	c.Set("b", 2) // a is evicted and untagged
+	tt.Eq(0, len(c.(*lruCache).tagged("t")))
+}
+
+func TestRedisInvalidator(t *testing.T) {
+	tt := test.Wrap(t)
+	server := newFakeRedis()
+	defer server.Close()
+	c, err := New(REDIS, "codec=gob&addr="+server.Addr())
+	tt.Nil(err)
+	testInvalidator(tt, c)
+	tt.Eq(uint64(6), c.Stats().Removals)
+
+	inv := c.(Invalidator)
+	inv.SetWithTags("a", 1, "t1", "t2")
+	inv.SetWithTags("b", 2, "t1")
+	c.Remove("b")
+	tt.Eq(1, len(server.sets[TAG_PREFIX+"t1"]))
+	c.Set("a", 3) // overwrite remove key from it's tags
+	tt.Eq(0, len(server.sets[TAG_PREFIX+"t1"]))
+	inv.SetWithTags("a", 4, "t1", "t2")
+	inv.InvalidateTag("t1")
+	tt.Eq(0, len(server.sets)) // a is removed from t2
+
+	rc := c.(*RedisCache)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tt.Eq(context.Canceled, rc.SetCtx(ctx, "a", 5))
+	tt.Eq(context.Canceled, rc.RemoveCtx(ctx, "a"))
+	tt.False(c.IsExist("a"))
+}
@@ -0,0 +1,324 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cosiner/gohper/config"
+)
+
+const (
+	// DEF_INVALIDATE_CHANNEL is the default redis channel to publish invalidation
+	DEF_INVALIDATE_CHANNEL = "gohper.cache.invalidate"
+
+	_RESUBSCRIBE_MIN = 100 * time.Millisecond // first delay to resubscribe after failure
+	_RESUBSCRIBE_MAX = 10 * time.Second       // max delay to resubscribe
+	_VERSION_SLOTS   = 256                    // count of invalidation versions
+)
+
+// tieredID is used to generate unique id for each tiered cache
+var tieredID uint64
+
+// tieredCache is a two-level cacher, level 1 is a local lru cache, level 2 is
+// redis, read through level 1 to level 2, write to both levels, and publish
+// the invalidation to other processes over redis pub/sub so that they drop
+// their local copies, to load value from backend when missing in both levels,
+// wrap it use NewLoading.
+//
+// If the subscription is broken, local cache is cleared and values read from
+// redis are not saved to local cache until resubscribed
+type tieredCache struct {
+	instrument
+	local      *lruCache
+	remote     *RedisCache
+	channel    string
+	id         string
+	subscribed int32                  // 1 if invalidation is being received
+	versions   [_VERSION_SLOTS]uint64 // invalidation versions of keys hashed by shardIndex
+	stop       chan struct{}
+	stopped    chan struct{}
+	once       sync.Once // destroy only once
+}
+
+// Init init tiered cacher, config format like l1.maxsize=1000&l2.addr=127.0.0.1:6379,
+// keys prefixed with l1. is config of local lru cache, keys prefixed with l2.
+// is config of RedisCache, l2.codec=gob make values from redis keep their type,
+// l2.channel is the channel to publish invalidation, default DEF_INVALIDATE_CHANNEL
+func (tc *tieredCache) Init(conf string) error {
+	return tc.InitVals(conf, nil)
+}
+
+// InitVals init tiered cacher with initial values, values will be write to
+// both levels
+func (tc *tieredCache) InitVals(conf string, values map[string]interface{}) (err error) {
+	l1, l2, channel := splitTieredConfig(conf)
+	tc.local, tc.remote = new(lruCache), new(RedisCache)
+	if err = tc.local.Init(l1); err != nil {
+		return
+	}
+	if err = tc.remote.Init(l2); err != nil {
+		return
+	}
+	tc.channel = channel
+	tc.id = strconv.FormatInt(time.Now().UnixNano(), 36) + "-" +
+		strconv.FormatUint(atomic.AddUint64(&tieredID, 1), 36)
+	unsubscribe, closed, err := tc.remote.RealStore().Subscribe(tc.onInvalidate, channel)
+	if err != nil {
+		return
+	}
+	tc.subscribed = 1
+	tc.stop, tc.stopped = make(chan struct{}), make(chan struct{})
+	go tc.subscribe(unsubscribe, closed)
+	for k, v := range values {
+		tc.Set(k, v)
+	}
+	return
+}
+
+// subscribe wait until subscription is broken or cache is destroyed, for
+// broken subscription, clear local cache and subscribe again with exponential
+// backoff, after resubscribed, local cache is cleared again to drop values
+// missed invalidation
+func (tc *tieredCache) subscribe(unsubscribe func(), closed <-chan struct{}) {
+	defer close(tc.stopped)
+	for {
+		select {
+		case <-closed:
+		case <-tc.stop:
+			unsubscribe()
+			return
+		}
+		atomic.StoreInt32(&tc.subscribed, 0)
+		tc.clear()
+		for backoff := _RESUBSCRIBE_MIN; ; {
+			var err error
+			unsubscribe, closed, err = tc.remote.RealStore().Subscribe(tc.onInvalidate, tc.channel)
+			if err == nil {
+				break
+			}
+			select {
+			case <-time.After(backoff):
+			case <-tc.stop:
+				return
+			}
+			if backoff *= 2; backoff > _RESUBSCRIBE_MAX {
+				backoff = _RESUBSCRIBE_MAX
+			}
+		}
+		tc.clear()
+		atomic.StoreInt32(&tc.subscribed, 1)
+	}
+}
+
+// clear remove all keys from local cache and invalidate all in-flight reads
+func (tc *tieredCache) clear() {
+	for i := range tc.versions {
+		atomic.AddUint64(&tc.versions[i], 1)
+	}
+	tc.local.RemovePrefix("")
+}
+
+// version return invalidation version of key
+func (tc *tieredCache) version(key string) uint64 {
+	return atomic.LoadUint64(&tc.versions[shardIndex(key, _VERSION_SLOTS)])
+}
+
+// bump increase invalidation version of key, it's called before key is
+// written so that in-flight reads of old value are not saved to local cache
+func (tc *tieredCache) bump(key string) {
+	atomic.AddUint64(&tc.versions[shardIndex(key, _VERSION_SLOTS)], 1)
+}
+
+// fill save value read from redis to local cache, ver is version of key
+// before reading, if key is invalidated after that, or invalidation is not
+// being received, value is not saved
+func (tc *tieredCache) fill(key string, val interface{}, ver uint64) {
+	if atomic.LoadInt32(&tc.subscribed) == 0 {
+		return
+	}
+	tc.local.Set(key, val)
+	if tc.version(key) != ver || atomic.LoadInt32(&tc.subscribed) == 0 {
+		tc.local.Remove(key)
+	}
+}
+
+// splitTieredConfig split tiered config to local and redis config and
+// invalidation channel
+func splitTieredConfig(conf string) (l1, l2, channel string) {
+	c := config.NewConfig(config.LINE)
+	c.ParseString(conf)
+	var l1s, l2s []string
+	channel = DEF_INVALIDATE_CHANNEL
+	for k, v := range c.SectionVals(c.CurrSec()) {
+		switch {
+		case k == "l2.channel":
+			channel = v
+		case strings.HasPrefix(k, "l1."):
+			l1s = append(l1s, k[len("l1."):]+"="+v)
+		case strings.HasPrefix(k, "l2."):
+			l2s = append(l2s, k[len("l2."):]+"="+v)
+		}
+	}
+	return strings.Join(l1s, "&"), strings.Join(l2s, "&"), channel
+}
+
+// onInvalidate handle invalidation message published by other processes,
+// message format is id:key
+func (tc *tieredCache) onInvalidate(_ string, data []byte) {
+	msg := string(data)
+	if i := strings.IndexByte(msg, ':'); i > 0 && msg[:i] != tc.id {
+		key := msg[i+1:]
+		tc.bump(key)
+		tc.local.Remove(key)
+	}
+}
+
+// invalidate publish invalidation of key to other processes
+func (tc *tieredCache) invalidate(key string) {
+	tc.remote.RealStore().Publish(tc.channel, tc.id+":"+key)
+}
+
+// Get return value from local cache, if not exist, from redis and save it
+// to local cache
+func (tc *tieredCache) Get(key string) interface{} {
+	val := tc.local.Get(key)
+	if val == nil {
+		ver := tc.version(key)
+		if val = tc.remote.Get(key); val != nil {
+			tc.fill(key, val, ver)
+		}
+	}
+	tc.recordGet(val != nil)
+	return val
+}
+
+// Set write key-value to both levels, and invalidate others' local copies
+func (tc *tieredCache) Set(key string, val interface{}) {
+	tc.bump(key)
+	tc.remote.Set(key, val)
+	tc.local.Set(key, val)
+	tc.invalidate(key)
+	tc.recordSet()
+}
+
+// Update only update key-value exist in redis
+func (tc *tieredCache) Update(key string, val interface{}) bool {
+	tc.bump(key)
+	if !tc.remote.Update(key, val) {
+		return false
+	}
+	tc.local.Set(key, val)
+	tc.invalidate(key)
+	tc.recordSet()
+	return true
+}
+
+// Remove remove key from both levels, and invalidate others' local copies
+func (tc *tieredCache) Remove(key string) {
+	tc.bump(key)
+	tc.remote.Remove(key)
+	tc.local.Remove(key)
+	tc.invalidate(key)
+	tc.recordRemove()
+}
+
+// IsExist check whether key exist in local cache or redis
+func (tc *tieredCache) IsExist(key string) bool {
+	return tc.local.IsExist(key) || tc.remote.IsExist(key)
+}
+
+// Size return current count of local cache
+func (tc *tieredCache) Size() int {
+	return tc.local.Size()
+}
+
+// Cap return capacity of local cache
+func (tc *tieredCache) Cap() int {
+	return tc.local.Cap()
+}
+
+// GetCtx return value from local cache, if not exist, from redis and save it
+// to local cache, errors of redis are returned
+func (tc *tieredCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	val, err := getCtx(ctx, tc.local, key)
+	if err == nil && val == nil {
+		ver := tc.version(key)
+		if val, err = tc.remote.GetCtx(ctx, key); val != nil {
+			tc.fill(key, val, ver)
+		}
+	}
+	tc.recordGet(val != nil)
+	return val, err
+}
+
+// SetCtx write key-value to redis, if success, write to local cache and
+// invalidate others' local copies
+func (tc *tieredCache) SetCtx(ctx context.Context, key string, val interface{}) error {
+	tc.bump(key)
+	err := tc.remote.SetCtx(ctx, key, val)
+	if err == nil {
+		tc.local.Set(key, val)
+		tc.invalidate(key)
+		tc.recordSet()
+	}
+	return err
+}
+
+// UpdateCtx only update key-value exist in redis
+func (tc *tieredCache) UpdateCtx(ctx context.Context, key string, val interface{}) (bool, error) {
+	tc.bump(key)
+	success, err := tc.remote.UpdateCtx(ctx, key, val)
+	if success {
+		tc.local.Set(key, val)
+		tc.invalidate(key)
+		tc.recordSet()
+	}
+	return success, err
+}
+
+// RemoveCtx remove key from both levels, and invalidate others' local copies,
+// local copy is always removed even if removing from redis failed
+func (tc *tieredCache) RemoveCtx(ctx context.Context, key string) error {
+	tc.bump(key)
+	err := tc.remote.RemoveCtx(ctx, key)
+	tc.local.Remove(key)
+	tc.invalidate(key)
+	tc.recordRemove()
+	return err
+}
+
+// IsExistCtx check whether key exist in local cache or redis
+func (tc *tieredCache) IsExistCtx(ctx context.Context, key string) (bool, error) {
+	if tc.local.IsExist(key) {
+		return true, nil
+	}
+	return tc.remote.IsExistCtx(ctx, key)
+}
+
+// SizeCtx return current count of local cache
+func (tc *tieredCache) SizeCtx(ctx context.Context) (int, error) {
+	return sizeCtx(ctx, tc.local)
+}
+
+// SetEvictHook set hook of eviction from local cache
+func (tc *tieredCache) SetEvictHook(hook EvictHook) {
+	tc.local.SetEvictHook(hook)
+}
+
+// Destroy stop receiving invalidation and destroy redis store, it's safe to
+// call it more than once
+func (tc *tieredCache) Destroy() {
+	tc.once.Do(func() {
+		if tc.stop != nil {
+			close(tc.stop)
+			<-tc.stopped
+		}
+		if tc.remote != nil && tc.remote.redisStore != nil {
+			tc.remote.redisStore.Destroy()
+		}
+	})
+}
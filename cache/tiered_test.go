@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cosiner/gohper/lib/test"
+)
+
+// waitInvalidated wait until tiered cache received invalidation of key after
+// version ver
+func waitInvalidated(c Cache, key string, ver uint64) {
+	tc := c.(*tieredCache)
+	for i := 0; i < 100 && tc.version(key) == ver; i++ {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	tt := test.Wrap(t)
+	server := newFakeRedis()
+	defer server.Close()
+
+	conf := "l1.maxsize=10&l2.codec=gob&l2.addr=" + server.Addr()
+	c1, err := New(TIERED, conf)
+	tt.Nil(err)
+	defer c1.(Destroyer).Destroy()
+	c2, err := New(TIERED, conf)
+	tt.Nil(err)
+	defer c2.(Destroyer).Destroy()
+	defer c2.(Destroyer).Destroy() // destroy again is allowed
+
+	ver := c2.(*tieredCache).version("a")
+	c1.Set("a", "1")
+	waitInvalidated(c2, "a", ver)
+	tt.Eq("1", c1.Get("a")) // from local
+	tt.Eq("1", c2.Get("a")) // from redis
+	tt.Eq(1, c2.Size())
+
+	c1.Set("a", "2") // c2's local copy is invalidated
+	for i := 0; i < 100 && c2.Size() != 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	tt.Eq(0, c2.Size())
+	tt.Eq("2", c2.Get("a"))
+	tt.Eq("2", c1.Get("a")) // own invalidation is ignored
+
+	tt.True(c2.Update("a", "3"))
+	tt.False(c2.Update("b", "3"))
+	c2.Remove("a")
+	for i := 0; i < 100 && c1.Size() != 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	tt.Eq(nil, c1.Get("a"))
+	tt.False(c2.IsExist("a"))
+
+	l := NewLoading(c1, func(key string) (interface{}, error) {
+		return "loaded", nil
+	}, 0)
+	defer l.Destroy()
+	val, _ := l.Get("b")
+	tt.Eq("loaded", val)
+	tt.Eq("loaded", c2.Get("b"))
+}
+
+func TestTieredResubscribe(t *testing.T) {
+	tt := test.Wrap(t)
+	server := newFakeRedis()
+	defer server.Close()
+
+	conf := "l1.maxsize=10&l2.codec=gob&l2.addr=" + server.Addr()
+	c1, err := New(TIERED, conf)
+	tt.Nil(err)
+	defer c1.(Destroyer).Destroy()
+	c2, err := New(TIERED, conf)
+	tt.Nil(err)
+	defer c2.(Destroyer).Destroy()
+
+	ver := c2.(*tieredCache).version("a")
+	c1.Set("a", "1")
+	waitInvalidated(c2, "a", ver)
+	c2.Get("a")
+	tt.Eq(1, c2.Size())
+
+	tc := c2.(*tieredCache)
+	ver = tc.version("a")
+	server.dropSubscribers()
+	// local cache is cleared once broken and once resubscribed
+	for i := 0; i < 1000 && (atomic.LoadInt32(&tc.subscribed) == 0 || tc.version("a")-ver < 2); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	tt.Eq(uint64(2), tc.version("a")-ver)
+	tt.Eq(0, c2.Size())
+
+	c2.Get("a")
+	tt.Eq(1, c2.Size())
+	c1.Set("a", "2")
+	for i := 0; i < 100 && c2.Size() != 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	tt.Eq(0, c2.Size())
+}
+
+func TestTieredFillInvalidated(t *testing.T) {
+	tt := test.Wrap(t)
+	server := newFakeRedis()
+	defer server.Close()
+
+	c, err := New(TIERED, "l1.maxsize=10&l2.addr="+server.Addr())
+	tt.Nil(err)
+	tc := c.(*tieredCache)
+	defer tc.Destroy()
+
+	ver := tc.version("a")
+	tc.onInvalidate(DEF_INVALIDATE_CHANNEL, []byte("other:a"))
+	tc.fill("a", "stale", ver)
+	tt.Eq(nil, tc.local.Get("a"))
+
+	tc.fill("a", "fresh", tc.version("a"))
+	tt.Eq("fresh", tc.local.Get("a"))
+
+	for _, write := range []func(){
+		func() { tc.Set("a", "new") },
+		func() { tc.Update("a", "new") },
+		func() { tc.Remove("a") },
+	} {
+		ver = tc.version("a")
+		write() // own write during a read of old value from redis
+		tc.fill("a", "old", ver)
+		tt.True(tc.local.Get("a") != "old")
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import "fmt"
+
+// KeyEncoder encode a typed key to the string key of underlying cache
+type KeyEncoder[K comparable] func(key K) string
+
+// Typed is a type safe facade of Cache, values of other type stored to the
+// underlying cache by other code are treated as missing instead of panic
+type Typed[K comparable, V any] struct {
+	cache  Cache
+	encode KeyEncoder[K]
+}
+
+// NewTyped create a typed facade of cache, if encode is nil, keys are encoded
+// by fmt.Sprint
+func NewTyped[K comparable, V any](cache Cache, encode KeyEncoder[K]) *Typed[K, V] {
+	if encode == nil {
+		encode = func(key K) string {
+			if s, is := any(key).(string); is {
+				return s
+			}
+			return fmt.Sprint(key)
+		}
+	}
+	return &Typed[K, V]{cache: cache, encode: encode}
+}
+
+// Cache return the underlying cache
+func (t *Typed[K, V]) Cache() Cache {
+	return t.cache
+}
+
+// Get return value of the key, if the key not exist or it's value is not type V,
+// false is returned, for cache with codec such as RedisCache, value is decoded
+// to type V directly
+func (t *Typed[K, V]) Get(key K) (val V, ok bool) {
+	k := t.encode(key)
+	if c, is := t.cache.(interface {
+		GetInto(key string, ptr interface{}) error
+	}); is {
+		err := c.GetInto(k, &val)
+		if err != ErrNoCodec {
+			if err != nil {
+				var zero V
+				return zero, false
+			}
+			return val, true
+		}
+	}
+	val, ok = t.cache.Get(k).(V)
+	return
+}
+
+// Set add an key-value to cache, if key already exist in cache, update it's value
+func (t *Typed[K, V]) Set(key K, val V) {
+	t.cache.Set(t.encode(key), val)
+}
+
+// Update only update existed key-value, returned value show whether it's successed
+func (t *Typed[K, V]) Update(key K, val V) bool {
+	return t.cache.Update(t.encode(key), val)
+}
+
+// Remove remove key and it's value from cache
+func (t *Typed[K, V]) Remove(key K) {
+	t.cache.Remove(t.encode(key))
+}
+
+// IsExist check whether key exist
+func (t *Typed[K, V]) IsExist(key K) bool {
+	return t.cache.IsExist(t.encode(key))
+}
+
+// Size return current cache count
+func (t *Typed[K, V]) Size() int {
+	return t.cache.Size()
+}
+
+// Cap return cache capacity
+func (t *Typed[K, V]) Cap() int {
+	return t.cache.Cap()
+}
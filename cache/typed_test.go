@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/cosiner/gohper/lib/test"
+)
+
+func TestTyped(t *testing.T) {
+	tt := test.Wrap(t)
+	for _, typ := range []CacherType{LRU, RANDOM} {
+		c, _ := New(typ, "maxsize=10")
+		tc := NewTyped[int, string](c, nil)
+		tc.Set(1, "a")
+		v, ok := tc.Get(1)
+		tt.True(ok)
+		tt.Eq("a", v)
+		tt.Eq("a", c.Get("1")) // underlying cache keep working
+
+		c.Set("2", 2) // wrong type is treated as missing
+		v, ok = tc.Get(2)
+		tt.False(ok)
+		tt.Eq("", v)
+
+		tt.True(tc.Update(1, "b"))
+		tt.False(tc.Update(3, "c"))
+		tc.Remove(1)
+		tt.False(tc.IsExist(1))
+	}
+
+	c, _ := New(LRU, "maxsize=10")
+	tc := NewTyped[int, int](c, func(key int) string {
+		return "user:" + strconv.Itoa(key)
+	})
+	tc.Set(1, 10)
+	tt.True(c.IsExist("user:1"))
+}
+
+func TestTypedRedis(t *testing.T) {
+	tt := test.Wrap(t)
+	server := newFakeRedis()
+	defer server.Close()
+
+	c, err := New(REDIS, "codec=json&addr="+server.Addr())
+	tt.Nil(err)
+	tc := NewTyped[string, codecUser](c, nil)
+	tc.Set("user", codecUser{"abc", 10})
+	u, ok := tc.Get("user")
+	tt.True(ok)
+	tt.Eq(codecUser{"abc", 10}, u)
+	_, ok = tc.Get("none")
+	tt.False(ok)
+
+	c, err = New(REDIS, "codec=raw&addr="+server.Addr()) // values are raw bytes
+	tt.Nil(err)
+	bc := NewTyped[string, []byte](c, nil)
+	bc.Set("bytes", []byte("abc"))
+	b, ok := bc.Get("bytes")
+	tt.True(ok)
+	tt.Eq("abc", string(b))
+}
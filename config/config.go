@@ -2,9 +2,15 @@
 package config
 
 import (
+	"io"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/cosiner/gohper/lib/reflect"
+	. "github.com/cosiner/gohper/lib/errors"
+	"github.com/cosiner/gohper/lib/sys"
 	"github.com/cosiner/gohper/lib/types"
 )
 
@@ -30,12 +36,22 @@ type ConfigParser interface {
 	SetSectionVals(section string, values map[string]string)
 }
 
+// ConfigWriter is implemented by parsers that can write config back
+type ConfigWriter interface {
+	// WriteTo write config to writer in parser's format
+	WriteTo(w io.Writer) (int64, error)
+	// SaveFile write config to file in parser's format
+	SaveFile(fname string) error
+}
+
+const ErrNotWritable = Err("Config parser can't be written back")
+
 // Config implements some common config function
 type Config struct {
 	ConfigParser
 }
 
-// ConfigType is supported config file type, currently only ini format
+// ConfigType is supported config file type
 type ConfigType int8
 
 const (
@@ -43,6 +59,11 @@ const (
 	INI ConfigType = iota
 	// LINE is the format like :k=v&k=v... config, no different sections
 	LINE
+	// JSON is the json format config, nested objects are sections, deeper
+	// nested objects are sections named by dotted path like db.replica
+	JSON
+	// TOML is a subset of toml format config, tables are sections
+	TOML
 )
 
 // NewConfig return a config parser, default use ini config parser
@@ -52,10 +73,32 @@ func NewConfig(typ ConfigType) (c *Config) {
 		c = &Config{newIniConfig()}
 	case LINE:
 		c = &Config{NewLineConfig()}
+	case JSON:
+		c = &Config{newJSONConfig()}
+	case TOML:
+		c = &Config{newTOMLConfig()}
 	}
 	return
 }
 
+// TypeOf detect config type by file extension, .json is JSON, .toml is TOML,
+// others are INI
+func TypeOf(path string) ConfigType {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON
+	case ".toml":
+		return TOML
+	}
+	return INI
+}
+
+// Load parse config file, config type is detected by file extension
+func Load(path string) (*Config, error) {
+	c := NewConfig(TypeOf(path))
+	return c, c.ParseFile(path)
+}
+
 // NewConfigWith use a gived parser
 func NewConfigWith(parser ConfigParser) *Config {
 	return &Config{parser}
@@ -105,6 +148,246 @@ func (c *Config) IntValDef(key string, defaultval int) int {
 	return c.IntValFrom(key, c.CurrSec(), defaultval)
 }
 
-func (c *Config) UnmarshalCurrSec(v interface{}) error {
-	return reflect.UnmarshalToStruct(c.SectionVals(c.CurrSec()), v)
+// parseValFrom parse value of key in section, it's an error if key not exist
+// or parse failed, error message contains section and key
+func (c *Config) parseValFrom(key, section string, parse func(string) error) error {
+	v, has := c.ValFrom(key, section)
+	if !has {
+		return Errorf("%s.%s: not found", section, key)
+	}
+	if err := parse(v); err != nil {
+		return Errorf("%s.%s: %s", section, key, err.Error())
+	}
+	return nil
+}
+
+// DurationValFromErr return duration value parsed by time.ParseDuration
+func (c *Config) DurationValFromErr(key, section string) (d time.Duration, err error) {
+	err = c.parseValFrom(key, section, func(v string) (err error) {
+		d, err = time.ParseDuration(v)
+		return
+	})
+	return
+}
+
+// DurationValFrom return duration value, on error return default value
+func (c *Config) DurationValFrom(key, section string, defaultval time.Duration) time.Duration {
+	if d, err := c.DurationValFromErr(key, section); err == nil {
+		return d
+	}
+	return defaultval
+}
+
+// DurationValErr return duration value from current section
+func (c *Config) DurationValErr(key string) (time.Duration, error) {
+	return c.DurationValFromErr(key, c.CurrSec())
+}
+
+// DurationValDef return duration value from current section
+func (c *Config) DurationValDef(key string, defaultval time.Duration) time.Duration {
+	return c.DurationValFrom(key, c.CurrSec(), defaultval)
+}
+
+// BytesValFromErr return byte size parsed by types.Str2Bytes, like 10M
+func (c *Config) BytesValFromErr(key, section string) (size uint64, err error) {
+	err = c.parseValFrom(key, section, func(v string) (err error) {
+		size, err = types.Str2Bytes(v)
+		return
+	})
+	return
+}
+
+// BytesValFrom return byte size, on error return default value
+func (c *Config) BytesValFrom(key, section string, defaultval uint64) uint64 {
+	if size, err := c.BytesValFromErr(key, section); err == nil {
+		return size
+	}
+	return defaultval
+}
+
+// BytesValErr return byte size from current section
+func (c *Config) BytesValErr(key string) (uint64, error) {
+	return c.BytesValFromErr(key, c.CurrSec())
+}
+
+// BytesValDef return byte size from current section
+func (c *Config) BytesValDef(key string, defaultval uint64) uint64 {
+	return c.BytesValFrom(key, c.CurrSec(), defaultval)
+}
+
+// FloatValFromErr return float value
+func (c *Config) FloatValFromErr(key, section string) (f float64, err error) {
+	err = c.parseValFrom(key, section, func(v string) (err error) {
+		f, err = strconv.ParseFloat(types.TrimSpace(v), 64)
+		return
+	})
+	return
+}
+
+// FloatValFrom return float value, on error return default value
+func (c *Config) FloatValFrom(key, section string, defaultval float64) float64 {
+	if f, err := c.FloatValFromErr(key, section); err == nil {
+		return f
+	}
+	return defaultval
+}
+
+// FloatValErr return float value from current section
+func (c *Config) FloatValErr(key string) (float64, error) {
+	return c.FloatValFromErr(key, c.CurrSec())
+}
+
+// FloatValDef return float value from current section
+func (c *Config) FloatValDef(key string, defaultval float64) float64 {
+	return c.FloatValFrom(key, c.CurrSec(), defaultval)
+}
+
+// ListValFromErr return list value separated by sep, each element is trimmed,
+// empty value is an empty list
+func (c *Config) ListValFromErr(key, section, sep string) (list []string, err error) {
+	err = c.parseValFrom(key, section, func(v string) error {
+		list = splitList(v, sep)
+		return nil
+	})
+	return
+}
+
+// ListValFrom return list value, on error return default value
+func (c *Config) ListValFrom(key, section, sep string, defaultval []string) []string {
+	if list, err := c.ListValFromErr(key, section, sep); err == nil {
+		return list
+	}
+	return defaultval
+}
+
+// ListValErr return list value from current section
+func (c *Config) ListValErr(key, sep string) ([]string, error) {
+	return c.ListValFromErr(key, c.CurrSec(), sep)
+}
+
+// ListValDef return list value from current section
+func (c *Config) ListValDef(key, sep string, defaultval []string) []string {
+	return c.ListValFrom(key, c.CurrSec(), sep, defaultval)
+}
+
+// MapValFromErr return map value in format k1:v1,k2:v2, keys and values are
+// trimmed
+func (c *Config) MapValFromErr(key, section string) (m map[string]string, err error) {
+	err = c.parseValFrom(key, section, func(v string) error {
+		m = make(map[string]string)
+		for _, entry := range splitList(v, ",") {
+			pair := types.ParsePair(entry, ":")
+			if !strings.Contains(entry, ":") || pair.Trim().NoKey() {
+				return Errorf("wrong format of map entry: %s", entry)
+			}
+			m[pair.Key] = pair.Value
+		}
+		return nil
+	})
+	if err != nil {
+		m = nil
+	}
+	return
+}
+
+// MapValFrom return map value, on error return default value
+func (c *Config) MapValFrom(key, section string, defaultval map[string]string) map[string]string {
+	if m, err := c.MapValFromErr(key, section); err == nil {
+		return m
+	}
+	return defaultval
+}
+
+// MapValErr return map value from current section
+func (c *Config) MapValErr(key string) (map[string]string, error) {
+	return c.MapValFromErr(key, c.CurrSec())
+}
+
+// MapValDef return map value from current section
+func (c *Config) MapValDef(key string, defaultval map[string]string) map[string]string {
+	return c.MapValFrom(key, c.CurrSec(), defaultval)
+}
+
+// splitList split string by sep, each element is trimmed, empty string is an
+// empty list
+func splitList(s, sep string) []string {
+	if s = types.TrimSpace(s); s == "" {
+		return []string{}
+	}
+	list := strings.Split(s, sep)
+	for i := range list {
+		list[i] = types.TrimSpace(list[i])
+	}
+	return list
+}
+
+// Sections return all section names of parser if it has a Sections method,
+// otherwise only the default section
+func Sections(p ConfigParser) []string {
+	if sp, is := p.(interface {
+		Sections() []string
+	}); is {
+		return sp.Sections()
+	}
+	return []string{p.DefSec()}
+}
+
+// WriteTo write config to writer if parser implements ConfigWriter
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+	if cw, is := c.ConfigParser.(ConfigWriter); is {
+		return cw.WriteTo(w)
+	}
+	return 0, ErrNotWritable
+}
+
+// SaveFile write config to file if parser implements ConfigWriter
+func (c *Config) SaveFile(fname string) error {
+	if cw, is := c.ConfigParser.(ConfigWriter); is {
+		return cw.SaveFile(fname)
+	}
+	return ErrNotWritable
+}
+
+// saveFile write config to a temporary file, then rename it to the file, so
+// the file is never partially written, permissions of existing file are kept,
+// new file use sys.FilePerm
+func saveFile(w io.WriterTo, fname string) error {
+	fname = sys.ExpandHome(fname)
+	fd, err := os.CreateTemp(filepath.Dir(fname), filepath.Base(fname)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	var perm os.FileMode = sys.FilePerm
+	if fi, e := os.Stat(fname); e == nil {
+		perm = fi.Mode().Perm()
+	}
+	if err = fd.Chmod(perm); err == nil {
+		_, err = w.WriteTo(fd)
+	}
+	if e := fd.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(fd.Name(), fname)
+	}
+	if err != nil {
+		os.Remove(fd.Name())
+	}
+	return err
+}
+
+// quoteValue quote value if it's empty, has leading or trailing spaces,
+// start with quote or contains comment character, the quote character is one
+// of ", ', ` that not appeared in value
+func quoteValue(val string) string {
+	if val != "" && types.TrimSpace(val) == val && !isQuote(val[0]) &&
+		!strings.ContainsRune(val, '#') {
+		return val
+	}
+	for _, q := range []string{`"`, "'", "`"} {
+		if !strings.Contains(val, q) {
+			return q + val + q
+		}
+	}
+	return `"` + val + `"`
 }
@@ -1,8 +1,17 @@
 package config
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	. "github.com/cosiner/gohper/lib/errors"
 	"github.com/cosiner/gohper/lib/test"
 )
 
@@ -144,3 +153,640 @@ func TestUnmarshakLine(t *testing.T) {
 	tt.Log(c.UnmarshalCurrSec(&v))
 	tt.Log(v)
 }
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestIniInclude(t *testing.T) {
+	tt := test.Wrap(t)
+	dir := writeFiles(t, map[string]string{
+		"base.ini": `
+[db]
+host=localhost
+port=3306
+[log]
+level=info
+`,
+		"env/prod.ini": `
+include = ../base.ini
+[db]
+host=db.prod
+`,
+		"env/local.ini": `
+[log]
+include=prod.ini
+level=debug
+`,
+	})
+	c := NewConfig(INI)
+	tt.Nil(c.ParseFile(filepath.Join(dir, "env/local.ini")))
+	tt.Eq("log", c.CurrSec())
+	tt.Eq("debug", c.ValDef("level", "")) // current section is restored after include
+	c.SetCurrSec("db")
+	tt.Eq("db.prod", c.ValDef("host", ""))
+	tt.Eq("3306", c.ValDef("port", ""))
+
+	dir = writeFiles(t, map[string]string{
+		"a.ini": "include=b.ini\n",
+		"b.ini": "include=a.ini\n",
+	})
+	err := NewConfig(INI).ParseFile(filepath.Join(dir, "a.ini"))
+	tt.NNil(err)
+	tt.True(strings.Contains(err.Error(), "cycle"))
+
+	tt.NNil(NewConfig(INI).ParseFile(filepath.Join(dir, "none.ini")))
+}
+
+func TestIniInterpolate(t *testing.T) {
+	tt := test.Wrap(t)
+	os.Setenv("GOHPER_TEST_HOST", "10.0.0.1")
+	os.Unsetenv("GOHPER_TEST_NONE")
+	c := NewConfig(INI)
+	tt.Nil(c.ParseString(`
+[db]
+host=${GOHPER_TEST_HOST}
+port=${GOHPER_TEST_NONE:-3306}
+addr=${db.host}:${db.port}
+url=mysql://${db.addr}/${app.name}
+user=${GOHPER_TEST_NONE:-${app.name}}
+price=$$10
+[app]
+name=gohper
+`))
+	c.SetCurrSec("db")
+	tt.Eq("10.0.0.1", c.ValDef("host", ""))
+	tt.Eq("3306", c.ValDef("port", ""))
+	tt.Eq("10.0.0.1:3306", c.ValDef("addr", ""))
+	tt.Eq("mysql://10.0.0.1:3306/gohper", c.ValDef("url", ""))
+	tt.Eq("gohper", c.ValDef("user", ""))
+	tt.Eq("$10", c.ValDef("price", ""))
+
+	tt.NNil(NewConfig(INI).ParseString("a=${GOHPER_TEST_NONE}"))
+	tt.NNil(NewConfig(INI).ParseString("a=${global.b}\nb=${global.a}"))
+	tt.NNil(NewConfig(INI).ParseString("a=${global.b"))
+}
+
+func TestIniWrite(t *testing.T) {
+	tt := test.Wrap(t)
+	content := `# global comment
+name=gohper
+
+[db]
+# database host
+host=localhost # trailing comment
+port=3306
+url="mysql://a#b"
+tmpl=$${X}
+
+[log]
+level=info
+`
+	c := NewConfig(INI)
+	tt.Nil(c.ParseString(content))
+	buf := bytes.NewBuffer(nil)
+	_, err := c.WriteTo(buf)
+	tt.Nil(err)
+	tt.Eq(content, buf.String())
+
+	c.SetCurrSec("db")
+	vals := c.SectionVals("db")
+	vals["host"] = " db.prod "
+	vals["user"] = ""
+	delete(vals, "port")
+	c.SetSectionVals("cache", map[string]string{"size": "10", "addr": `it's "quoted"`})
+	c.SetSectionVals("log", nil)
+
+	path := filepath.Join(t.TempDir(), "app.ini")
+	tt.Nil(c.SaveFile(path))
+	data, _ := ioutil.ReadFile(path)
+	tt.Eq(`# global comment
+name=gohper
+
+[db]
+# database host
+host=" db.prod " # trailing comment
+url="mysql://a#b"
+tmpl=$${X}
+user=""
+
+[cache]
+addr=it's "quoted"
+size=10
+`, string(data))
+
+	c = NewConfig(INI)
+	tt.Nil(c.ParseFile(path))
+	c.SetCurrSec("db")
+	tt.Eq(" db.prod ", c.ValDef("host", ""))
+	tt.Eq("mysql://a#b", c.ValDef("url", ""))
+	tt.Eq("${X}", c.ValDef("tmpl", ""))
+	v, has := c.Val("user")
+	tt.True(has)
+	tt.Eq("", v)
+	c.SetCurrSec("cache")
+	tt.Eq(`it's "quoted"`, c.ValDef("addr", ""))
+
+	tt.Nil(os.Chmod(path, 0600))
+	tt.Nil(c.SaveFile(path))
+	fi, err := os.Stat(path)
+	tt.Nil(err)
+	tt.Eq(os.FileMode(0600), fi.Mode().Perm())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tt.Nil(c.SaveFile(path))
+		}()
+	}
+	wg.Wait()
+	tt.NNil(saveFile(errWriterTo{}, path))
+	tmps, _ := filepath.Glob(path + ".*.tmp")
+	tt.Eq(0, len(tmps))
+}
+
+// errWriterTo always fail to write
+type errWriterTo struct{}
+
+func (errWriterTo) WriteTo(io.Writer) (int64, error) {
+	return 0, Err("write failed")
+}
+
+func TestIniWriteRaw(t *testing.T) {
+	tt := test.Wrap(t)
+	os.Setenv("GOHPER_TEST_PASSWORD", "s3cret")
+	dir := writeFiles(t, map[string]string{
+		"inc.ini": "[db]\nport=3306\nuser=root\n",
+		"app.ini": `include = inc.ini # shared
+[db]
+password=${GOHPER_TEST_PASSWORD}
+host=localhost
+`,
+	})
+	path := filepath.Join(dir, "app.ini")
+	c := NewConfig(INI)
+	tt.Nil(c.ParseFile(path))
+	c.SetCurrSec("db")
+	tt.Eq("s3cret", c.ValDef("password", ""))
+	vals := c.SectionVals("db")
+	vals["host"] = "${db.port}"
+	vals["user"] = "admin"
+	tt.Nil(c.SaveFile(path))
+	data, _ := ioutil.ReadFile(path)
+	tt.Eq(`include=inc.ini # shared
+[db]
+password=${GOHPER_TEST_PASSWORD}
+host=$${db.port}
+user=admin
+`, string(data))
+
+	c = NewConfig(INI)
+	tt.Nil(c.ParseFile(path))
+	c.SetCurrSec("db")
+	tt.Eq("${db.port}", c.ValDef("host", ""))
+	tt.Eq("3306", c.ValDef("port", ""))
+	tt.Eq("admin", c.ValDef("user", ""))
+}
+
+func TestLineWrite(t *testing.T) {
+	tt := test.Wrap(t)
+	c := NewConfig(LINE)
+	tt.Nil(c.ParseString("b=1&a=2&c= 3 "))
+	c.SectionVals("")["d"] = " 4 "
+	buf := bytes.NewBuffer(nil)
+	_, err := c.WriteTo(buf)
+	tt.Nil(err)
+	tt.Eq(`b=1&a=2&c=3&d=" 4 "`, buf.String())
+
+	c.SectionVals("")["e"] = "a&b"
+	_, err = c.WriteTo(buf)
+	tt.NNil(err)
+}
+
+func TestWatch(t *testing.T) {
+	tt := test.Wrap(t)
+	path := filepath.Join(t.TempDir(), "app.ini")
+	write := func(content string, modTime time.Time) {
+		ioutil.WriteFile(path, []byte(content), 0644)
+		os.Chtimes(path, modTime, modTime)
+	}
+	now := time.Now()
+	write("[log]\nlevel=info\n[cache]\nsize=10\nshards=4\n", now)
+
+	c, err := WatchEvery(path, INI, 5*time.Millisecond)
+	tt.Nil(err)
+	defer c.StopWatch()
+	tt.Eq("log", c.CurrSec())
+	tt.Eq("info", c.ValDef("level", ""))
+
+	diffs := make(chan Diff, 1)
+	tt.Nil(c.Subscribe(func(d Diff) {
+		diffs <- d
+	}))
+
+	write("[log]\nlevel=debug\n[cache]\nsize=10\nttl=1m\n[db]\nhost=localhost\n", now.Add(time.Second))
+	var diff Diff
+	select {
+	case diff = <-diffs:
+	case <-time.After(time.Second):
+		t.Fatal("config is not reloaded")
+	}
+	tt.Eq(3, len(diff))
+	tt.Eq("debug", diff["log"].Changed["level"])
+	tt.Eq("1m", diff["cache"].Added["ttl"])
+	tt.Eq("4", diff["cache"].Removed["shards"])
+	tt.Eq("localhost", diff["db"].Added["host"])
+	tt.Eq("debug", c.ValDef("level", ""))
+
+	write("[log\n", now.Add(2*time.Second)) // wrong format, old values are kept
+	time.Sleep(30 * time.Millisecond)
+	tt.Eq("debug", c.ValDef("level", ""))
+
+	tt.Eq(ErrNotWatched, NewConfig(INI).Subscribe(nil))
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			c.SetSectionVals("log", map[string]string{"level": "warn"})
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		c.SectionVals("log")["level"] = "none" // copy is returned
+		c.ValFrom("level", "log")
+	}
+	<-done
+	tt.Eq("warn", c.ValDef("level", ""))
+	write("[log]\nlevel=error\n", now.Add(3*time.Second))
+	select {
+	case <-diffs:
+	case <-time.After(time.Second):
+		t.Fatal("config is not reloaded")
+	}
+	tt.Eq("error", c.ValDef("level", ""))
+}
+
+func TestJSON(t *testing.T) {
+	tt := test.Wrap(t)
+	c := NewConfig(JSON)
+	tt.Nil(c.ParseString(`{
+	"name": "gohper",
+	"db": {
+		"host": "localhost",
+		"port": 3306,
+		"debug": true,
+		"password": null,
+		"replica": {"host": "replica", "ports": [3307, 3308]},
+		"opts": [{"a": 1}]
+	}
+}`))
+	tt.Eq(GLOBAL_OPTION, c.CurrSec())
+	tt.Eq("gohper", c.ValDef("name", ""))
+	tt.Eq(3306, c.IntValFrom("port", "db", 0))
+	tt.True(c.BoolValFrom("debug", "db", false))
+	v, has := c.ValFrom("password", "db")
+	tt.True(has)
+	tt.Eq("", v)
+	v, _ = c.ValFrom("ports", "db.replica")
+	tt.Eq("3307,3308", v)
+	v, _ = c.ValFrom("opts", "db")
+	tt.Eq(`[{"a":1}]`, v)
+	tt.NNil(NewConfig(JSON).ParseString(`[1, 2]`))
+	tt.NNil(NewConfig(JSON).ParseString(`{"a": 1`))
+}
+
+func TestTOML(t *testing.T) {
+	tt := test.Wrap(t)
+	c := NewConfig(TOML)
+	tt.Nil(c.ParseString(`
+# comment
+name = "gohper\tgo" # trailing comment
+
+[db]
+host = 'local#host'
+port = 3_306
+hosts = ["a", 'b', "c,d"] # comment
+replica.host = "replica"
+
+[ "log" ]
+level = "info"
+`))
+	tt.Eq(GLOBAL_OPTION, c.CurrSec())
+	tt.Eq("gohper\tgo", c.ValDef("name", ""))
+	c.SetCurrSec("db")
+	tt.Eq("local#host", c.ValDef("host", ""))
+	tt.Eq(3306, c.IntValDef("port", 0))
+	tt.Eq("a,b,c,d", c.ValDef("hosts", ""))
+	v, _ := c.ValFrom("host", "db.replica")
+	tt.Eq("replica", v)
+	v, _ = c.ValFrom("level", "log")
+	tt.Eq("info", v)
+
+	for _, s := range []string{"a = ", "a = [1, 2", "a = {b = 1}", "[[a]]", "[a", `a = "b`, "a = 1 2"} {
+		tt.NNil(NewConfig(TOML).ParseString(s))
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tt := test.Wrap(t)
+	dir := writeFiles(t, map[string]string{
+		"a.json": `{"db": {"port": 1}}`,
+		"a.toml": "[db]\nport = 2",
+		"a.conf": "[db]\nport=3",
+	})
+	for i, name := range []string{"a.json", "a.toml", "a.conf"} {
+		c, err := Load(filepath.Join(dir, name))
+		tt.Nil(err)
+		tt.Eq(i+1, c.IntValDef("port", 0))
+	}
+}
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = 0
+	case "info":
+		*l = 1
+	default:
+		return Errorf("unknown level %s", text)
+	}
+	return nil
+}
+
+func TestUnmarshalSection(t *testing.T) {
+	tt := test.Wrap(t)
+	type Replica struct {
+		Host string `config:",required"`
+	}
+	type DB struct {
+		Host    string
+		Port    int           `config:"port,default=3306"`
+		Timeout time.Duration `config:"timeout,default=1s"`
+		Hosts   []string      `config:"hosts,default=a, b"`
+		Buffer  uint64        `config:"buffer,bytes"`
+		Debug   bool          `config:"debug"`
+		Ignored string        `config:"-"`
+		Replica Replica
+		Backup  *Replica `config:"backup"`
+	}
+	type App struct {
+		Name  string `config:"name,required"`
+		Level level  `config:"level"`
+		Ratio float32
+		DB    DB
+	}
+
+	c := NewConfig(INI)
+	tt.Nil(c.ParseString(`
+name=gohper
+level=info
+ratio=0.5
+[db]
+host=localhost
+timeout=5s
+buffer=4K
+debug=true
+Ignored=abc
+[db.replica]
+host=replica
+`))
+	var app App
+	tt.Nil(c.UnmarshalCurrSec(&app))
+	tt.Eq("gohper", app.Name)
+	tt.Eq(level(1), app.Level)
+	tt.Eq(float32(0.5), app.Ratio)
+	tt.Eq("localhost", app.DB.Host)
+	tt.Eq(3306, app.DB.Port)
+	tt.Eq(5*time.Second, app.DB.Timeout)
+	tt.Eq(2, len(app.DB.Hosts))
+	tt.Eq("b", app.DB.Hosts[1])
+	tt.Eq(uint64(4096), app.DB.Buffer)
+	tt.True(app.DB.Debug)
+	tt.Eq("", app.DB.Ignored)
+	tt.Eq("replica", app.DB.Replica.Host)
+	tt.True(app.DB.Backup == nil)
+
+	c = NewConfig(INI)
+	tt.Nil(c.ParseString(`
+level=warn
+[db]
+port=abc
+debug=yes
+`))
+	err := c.UnmarshalSection(GLOBAL_OPTION, &app)
+	errs, is := err.(UnmarshalErrors)
+	tt.True(is)
+	tt.Eq(5, len(errs))
+	msg := err.Error()
+	for _, s := range []string{"global.name: required", "global.level", "db.port", "db.debug", "db.Replica.Host: required"} {
+		tt.True(strings.Contains(msg, s))
+	}
+
+	tt.NNil(c.UnmarshalCurrSec(app))
+
+	var sizes struct {
+		Size  int64  `config:"size,bytes"`
+		Limit uint32 `config:"limit,bytes"`
+	}
+	c = NewConfig(INI)
+	tt.Nil(c.ParseString("[s]\nsize=\"\"\nlimit=\" \""))
+	tt.NNil(c.UnmarshalSection("s", &sizes)) // empty size is an error
+}
+
+func TestTypedVals(t *testing.T) {
+	tt := test.Wrap(t)
+	c := NewConfig(INI)
+	tt.Nil(c.ParseString(`
+[app]
+timeout=1m30s
+buffer=16K
+ratio=0.75
+hosts=a; b ;c
+empty=""
+labels=env:prod, zone : us
+bad=abc
+badmap=a:1,b
+`))
+	tt.Eq(90*time.Second, c.DurationValDef("timeout", 0))
+	tt.Eq(time.Second, c.DurationValDef("bad", time.Second))
+	tt.Eq(uint64(16384), c.BytesValDef("buffer", 0))
+	tt.Eq(0.75, c.FloatValFrom("ratio", "app", 0))
+	tt.Eq(3, len(c.ListValDef("hosts", ";", nil)))
+	tt.Eq("b", c.ListValDef("hosts", ";", nil)[1])
+	tt.Eq(0, len(c.ListValDef("empty", ",", nil)))
+	tt.Eq("d", c.ListValDef("none", ",", []string{"d"})[0])
+	labels := c.MapValDef("labels", nil)
+	tt.Eq(2, len(labels))
+	tt.Eq("us", labels["zone"])
+	tt.True(c.MapValDef("badmap", nil) == nil)
+
+	_, err := c.DurationValErr("bad")
+	tt.True(strings.HasPrefix(err.Error(), "app.bad: "))
+	_, err = c.BytesValErr("empty")
+	tt.NNil(err)
+	_, err = c.FloatValFromErr("bad", "app")
+	tt.NNil(err)
+	_, err = c.ListValErr("none", ",")
+	tt.Eq("app.none: not found", err.Error())
+	_, err = c.MapValErr("badmap")
+	tt.NNil(err)
+}
+
+func TestLayered(t *testing.T) {
+	tt := test.Wrap(t)
+	ini := NewConfig(INI)
+	tt.Nil(ini.ParseString(`
+name=app
+[db]
+host=localhost
+port=3306
+user=root
+`))
+	os.Setenv("LAYERED_DB_PORT", "3307")
+	os.Setenv("LAYERED_DB_USER", "admin")
+	os.Setenv("LAYERED_NAME", "env")
+	defer os.Unsetenv("LAYERED_DB_PORT")
+	defer os.Unsetenv("LAYERED_DB_USER")
+	defer os.Unsetenv("LAYERED_NAME")
+
+	l := NewLayered(ini.ConfigParser, "layered", []string{
+		"run", "--db.port=3308", "--cache.enable", "--name=flag", "--", "--db.host=ignored",
+	})
+	c := NewConfigWith(l)
+	tt.Eq("LAYERED_DB_PORT", l.EnvName("port", "db"))
+	tt.Eq("LAYERED_NAME", l.EnvName("name", GLOBAL_OPTION))
+
+	val, src, has := l.Lookup("port", "db")
+	tt.True(has)
+	tt.Eq("3308", val)
+	tt.Eq(SOURCE_FLAG, src)
+	_, src, _ = l.Lookup("user", "db")
+	tt.Eq(SOURCE_ENV, src)
+	_, src, _ = l.Lookup("host", "db")
+	tt.Eq(SOURCE_FILE, src)
+	tt.Eq(3308, c.IntValFrom("port", "db", 0))
+	val, _ = c.ValFrom("user", "db")
+	tt.Eq("admin", val)
+	val, _ = c.ValFrom("name", GLOBAL_OPTION)
+	tt.Eq("flag", val)
+	tt.True(c.BoolValFrom("enable", "cache", false))
+	tt.True(c.HasSection("cache"))
+
+	vals := c.SectionVals("db")
+	tt.Eq(3, len(vals))
+	tt.Eq("3308", vals["port"])
+	val, _ = ini.ValFrom("port", "db")
+	tt.Eq("3306", val)
+
+	var buf bytes.Buffer
+	tt.Nil(l.WriteReport(&buf))
+	report := buf.String()
+	tt.True(strings.Contains(report, "[cache]\n"))
+	tt.True(strings.Contains(report, "(flag --db.port)"))
+	tt.True(strings.Contains(report, "(env LAYERED_DB_USER)"))
+	tt.True(strings.Contains(report, "(file)"))
+	tt.False(strings.Contains(report, "ignored"))
+}
+
+func TestIniSyntax(t *testing.T) {
+	tt := test.Wrap(t)
+	c := NewConfig(INI)
+	tt.Nil(c.ParseString(`; comment
+[app]
+color="#ff0000" ; red
+url='http://host/a;b#frag'
+raw=` + "`a\\nb`" + `
+escaped="tab\there\n\"q\" \\ \#"
+hash=a\#b # comment
+long=first \
+    second \
+  third
+multi="one \
+    two"
+hosts[]=a
+hosts[]=b
+hosts[]=c
+semi=a;b
+`))
+	c.SetCurrSec("app")
+	tt.Eq("#ff0000", c.ValDef("color", ""))
+	tt.Eq("http://host/a;b#frag", c.ValDef("url", ""))
+	tt.Eq(`a\nb`, c.ValDef("raw", ""))
+	tt.Eq("tab\there\n\"q\" \\ #", c.ValDef("escaped", ""))
+	tt.Eq("a#b", c.ValDef("hash", ""))
+	tt.Eq("first second third", c.ValDef("long", ""))
+	tt.Eq("one two", c.ValDef("multi", ""))
+	tt.Eq("a,b,c", c.ValDef("hosts", ""))
+	tt.Eq("a;b", c.ValDef("semi", ""))
+
+	buf := bytes.NewBuffer(nil)
+	_, err := c.WriteTo(buf)
+	tt.Nil(err)
+	c2 := NewConfig(INI)
+	tt.Nil(c2.ParseString(buf.String()))
+	for key, val := range c.SectionVals("app") {
+		v, _ := c2.ValFrom(key, "app")
+		tt.Eq(val, v)
+	}
+
+	for content, pos := range map[string][2]int{
+		"[app]\nkey":                {2, 4},
+		"[app\n":                    {1, 5},
+		"a=1\n[app]\n  key=\"abc":   {3, 7},
+		"a=1\nkey=\"a\\qb\"":        {2, 7},
+		"key=\"a\" b":               {1, 9},
+		"key=":                      {1, 5},
+		"key=\"a \\\n  b\" x":       {2, 6},
+		"key=\"abc \\\n   def\\x\"": {2, 7},
+		"[]":                        {1, 2},
+	} {
+		err := NewConfig(INI).ParseString(content)
+		if perr, is := err.(*ParseError); !is || perr.Line != pos[0] || perr.Column != pos[1] {
+			t.Errorf("%q: expect error at %v, got %v", content, pos, err)
+		}
+	}
+	err = NewConfig(INI).ParseString("key=\"a\\qb\"")
+	tt.Eq(`line 1, column 7: unknown escape sequence \q`, err.Error())
+
+	path := filepath.Join(t.TempDir(), "bad.ini")
+	tt.Nil(ioutil.WriteFile(path, []byte("[app]\nkey=\\"), 0644))
+	err = NewConfig(INI).ParseFile(path)
+	tt.Eq(path+":2:5: unexpected end of input after line continuation", err.Error())
+}
+
+func TestLayeredNoGlobal(t *testing.T) {
+	tt := test.Wrap(t)
+	ini := NewConfig(INI)
+	tt.Nil(ini.ParseString("[db]\nport=3306\n"))
+	tt.Eq("db", ini.DefSec())
+	os.Setenv("APP_DB_PORT", "1")
+	defer os.Unsetenv("APP_DB_PORT")
+	os.Setenv("APP_PORT", "2")
+	defer os.Unsetenv("APP_PORT")
+
+	l := NewLayered(ini.ConfigParser, "APP", []string{"--port=3"})
+	tt.Eq("APP_DB_PORT", l.EnvName("port", "db"))
+	tt.Eq("APP_PORT", l.EnvName("port", GLOBAL_OPTION))
+	val, src, _ := l.Lookup("port", "db")
+	tt.Eq("1", val)
+	tt.Eq(SOURCE_ENV, src)
+	val, src, _ = l.Lookup("port", GLOBAL_OPTION)
+	tt.Eq("3", val)
+	tt.Eq(SOURCE_FLAG, src)
+	var buf bytes.Buffer
+	tt.Nil(l.WriteReport(&buf))
+	tt.True(strings.Contains(buf.String(), "(env APP_DB_PORT)"))
+	tt.True(strings.Contains(buf.String(), "[global]\nport"))
+}
@@ -1,8 +1,14 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	. "github.com/cosiner/gohper/lib/errors"
 
@@ -14,23 +20,40 @@ import (
 // all key-value pairs will be placed under this section
 const (
 	GLOBAL_OPTION = "global"
-	ErrNoContent  = Err("No Content")
+	// INCLUDE is the directive key to include another file, relative path is
+	// resolved relative to the including file
+	INCLUDE      = "include"
+	ErrNoContent = Err("No Content")
 )
 
 // iniConfig implements a ini format parser
 type iniConfig struct {
-	currSec string // current section
-	defSec  string
-	values  map[string]map[string]string // values : [section]([key]value)
+	sectionValues
+	layout []*iniSection                 // sections of parsed files, for writing back
+	raws   map[string]map[string]*iniRaw // section to raw values of parsed keys
 }
 
-// ValFrom return value from section with gived key
-func (ic *iniConfig) ValFrom(key, section string) (val string, has bool) {
-	var vals map[string]string
-	if vals, has = ic.values[section]; has {
-		val, has = vals[key]
-	}
-	return
+// iniRaw is the value of a key as it's written in file, before interpolation
+type iniRaw struct {
+	raw      string
+	expanded string // value after interpolation
+	included bool   // bound by an included file
+}
+
+// iniSection is the lines of a section in parsed files, multi same sections
+// are merged
+type iniSection struct {
+	name  string
+	lines []iniLine
+}
+
+// iniLine is a line of parsed file, if key and include are both empty, it's
+// a blank line or comment line, otherwise it's a key-value or include
+// directive with an optional trailing comment
+type iniLine struct {
+	key     string
+	include string
+	comment string
 }
 
 // ParseString parse from string
@@ -39,135 +62,571 @@ func (ic *iniConfig) ParseString(content string) error {
 		return ErrNoContent
 	}
 
-	return ic.parse(types.StringReader(content))
+	p := newIniParser(ic)
+	return p.done(p.parse(types.StringReader(content), ""))
 }
 
 // ParseFile parse from file
 func (ic *iniConfig) ParseFile(confFileName string) (err error) {
-	return sys.OpenForRead(confFileName, func(fd *os.File) error {
-		return ic.parse(fd)
-	})
+	p := newIniParser(ic)
+	return p.done(p.parseFile(confFileName))
 }
 
 // newIniConfig return a ini config parser
 func newIniConfig() ConfigParser {
 	return &iniConfig{
-		values: make(map[string]map[string]string),
+		sectionValues: newSectionValues(),
+		raws:          make(map[string]map[string]*iniRaw),
 	}
 }
 
-// DefSec return first section of config
-func (ic *iniConfig) DefSec() string {
-	return ic.defSec
+// layoutSection return layout of section, if not exist, create it
+func (ic *iniConfig) layoutSection(section string) *iniSection {
+	for _, sec := range ic.layout {
+		if sec.name == section {
+			return sec
+		}
+	}
+	sec := &iniSection{name: section}
+	ic.layout = append(ic.layout, sec)
+	return sec
 }
 
-// CurrSec return current section
-func (ic *iniConfig) CurrSec() string {
-	return ic.currSec
+// WriteTo write config to writer in ini format, sections, keys and include
+// directives of parsed file keep their order and comments, others are sorted
+// and appended, global section is written first without section header.
+// Unchanged values are written as they are in file without interpolation,
+// unchanged values from included files are not written, changed values are
+// written with $ escaped as $$ so that they are not interpolated again, keys
+// from included files can't be removed
+func (ic *iniConfig) WriteTo(w io.Writer) (int64, error) {
+	var (
+		buf      bytes.Buffer
+		names    = []string{GLOBAL_OPTION}
+		sections = map[string]*iniSection{GLOBAL_OPTION: nil}
+	)
+	for _, sec := range ic.layout {
+		if _, has := sections[sec.name]; !has {
+			names = append(names, sec.name)
+		}
+		sections[sec.name] = sec
+	}
+	var added []string
+	for name := range ic.values {
+		if _, has := sections[name]; !has {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	names = append(names, added...)
+
+	for _, name := range names {
+		vals, lay := ic.values[name], sections[name]
+		var lines []iniLine
+		if lay != nil {
+			lines = lay.lines
+		}
+		written := make(map[string]bool, len(vals))
+		keys := make([]string, 0, len(vals))
+		for key := range vals {
+			if _, included := ic.valueText(name, key, vals[key]); included {
+				written[key] = true
+			} else {
+				keys = append(keys, key)
+			}
+		}
+		if lay == nil && len(keys) == 0 || vals == nil && name != GLOBAL_OPTION {
+			continue
+		}
+		if name != GLOBAL_OPTION {
+			if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n\n")) && lay == nil {
+				buf.WriteByte('\n')
+			}
+			buf.WriteString("[" + name + "]\n")
+		}
+		tail := len(lines) // new keys are written before trailing blank lines
+		for tail > 0 && lines[tail-1].key == "" && lines[tail-1].include == "" && lines[tail-1].comment == "" {
+			tail--
+		}
+		for _, line := range lines[:tail] {
+			switch {
+			case line.include != "":
+				writeLine(&buf, INCLUDE, iniQuote(line.include), line.comment)
+			case line.key == "":
+				buf.WriteString(line.comment + "\n")
+			case !written[line.key]:
+				if val, has := vals[line.key]; has {
+					written[line.key] = true
+					text, _ := ic.valueText(name, line.key, val)
+					writeLine(&buf, line.key, text, line.comment)
+				}
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !written[key] {
+				text, _ := ic.valueText(name, key, vals[key])
+				writeLine(&buf, key, text, "")
+			}
+		}
+		for range lines[tail:] {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+// valueText return text to write for value of key, if value is not changed
+// since parsing, it's raw text in file, included is true if it's from an
+// included file, changed value is escaped and quoted
+func (ic *iniConfig) valueText(section, key, val string) (text string, included bool) {
+	if r := ic.raws[section][key]; r != nil && r.expanded == val {
+		return iniQuote(r.raw), r.included
+	}
+	return iniQuote(strings.Replace(val, "$", "$$", -1)), false
 }
 
-// SetCurrSec set current section
-func (ic *iniConfig) SetCurrSec(section string) {
-	if section != "" {
-		ic.currSec = section
-		if ic.defSec == "" {
-			ic.defSec = section
+// writeLine write a key-value line with optional comment
+func writeLine(buf *bytes.Buffer, key, text, comment string) {
+	buf.WriteString(key + "=" + text)
+	if comment != "" {
+		buf.WriteString(" " + comment)
+	}
+	buf.WriteByte('\n')
+}
+
+// SaveFile write config to file in ini format
+func (ic *iniConfig) SaveFile(fname string) error {
+	return saveFile(ic, fname)
+}
+
+// ParseError is an error of ini content with it's position, line and column
+// start from 1, column is byte offset in line, file is empty when parsing
+// string
+type ParseError struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+}
+
+// iniParser parse content and included files to iniConfig, values bound
+// during parsing are interpolated after all files are parsed
+type iniParser struct {
+	ic        *iniConfig
+	files     []string                   // files being parsed, for cycle detection
+	including int                        // depth of included files being parsed
+	bound     map[string]map[string]bool // keys bound in this parsing
+	arrays    map[string]map[string]bool // array keys bound in this parsing
+	raws      map[string]map[string]bool // keys whose raw value is recorded in this parsing
+}
+
+// newIniParser return a parser bind values to ic
+func newIniParser(ic *iniConfig) *iniParser {
+	return &iniParser{
+		ic:     ic,
+		bound:  make(map[string]map[string]bool),
+		arrays: make(map[string]map[string]bool),
+		raws:   make(map[string]map[string]bool),
+	}
+}
+
+// done interpolate bound values, record expanded values of raw values and
+// reset current section if there is no error
+func (p *iniParser) done(err error) error {
+	if err == nil {
+		err = p.interpolate()
+	}
+	if err == nil {
+		for sec, keys := range p.raws {
+			for key := range keys {
+				p.ic.raws[sec][key].expanded = p.ic.values[sec][key]
+			}
 		}
+		p.ic.SetCurrSec(p.ic.DefSec())
 	}
+	return err
 }
 
-// HasSection check whether given section exist in config
-func (ic *iniConfig) HasSection(section string) bool {
-	return ic.values[section] != nil
+// parseFile parse a file, it's an error if file is already being parsed
+func (p *iniParser) parseFile(fname string) error {
+	path, err := filepath.Abs(sys.ExpandHome(fname))
+	if err != nil {
+		return err
+	}
+	for _, f := range p.files {
+		if f == path {
+			return Errorf("Include cycle: %s -> %s", strings.Join(p.files, " -> "), path)
+		}
+	}
+	p.files = append(p.files, path)
+	err = sys.OpenForRead(path, func(fd *os.File) error {
+		return p.parse(fd, filepath.Dir(path))
+	})
+	p.files = p.files[:len(p.files)-1]
+	return err
 }
 
-// addsection prepare space for new section if section not exist
-func (ic *iniConfig) addSection(section string) *iniConfig {
-	if !ic.HasSection(section) {
-		ic.values[section] = make(map[string]string)
+// parse read and parse from a reader, included files are resolved relative
+// to dir, after include, current section is restored
+func (p *iniParser) parse(reader io.Reader, dir string) error {
+	var l logicalLine
+	err := sys.FilterLine(reader, func(linenum int, line []byte) error {
+		l.add(linenum, string(line))
+		e, err := parseLine(l.text)
+		if err != nil {
+			return p.errorAt(&l, err)
+		}
+		if e.typ == _CONTINUE {
+			l.text = l.text[:len(l.text)-1] // remove backslash
+			return nil
+		}
+		l.reset()
+		return p.addEntry(&e, dir)
+	})
+	if err == nil && len(l.parts) > 0 {
+		err = p.errorAt(&l, &lineError{len(l.text), "unexpected end of input after line continuation"})
+	}
+	return err
+}
+
+// addEntry bind a parsed line to config, array values are joined by comma
+func (p *iniParser) addEntry(e *iniEntry, dir string) error {
+	ic := p.ic
+	switch e.typ {
+	case _SECTION:
+		ic.addSection(e.key).SetCurrSec(e.key)
+		if p.including == 0 {
+			ic.layoutSection(e.key)
+		}
+	case _BLANK:
+		p.addLine(iniLine{comment: e.comment})
+	case _KV:
+		if e.key == INCLUDE {
+			fname := e.value
+			if !filepath.IsAbs(fname) && !strings.HasPrefix(fname, "~") {
+				fname = filepath.Join(dir, fname)
+			}
+			p.addLine(iniLine{include: e.value, comment: e.comment})
+			currSec := ic.currSec
+			p.including++
+			err := p.parseFile(fname)
+			p.including--
+			ic.currSec = currSec
+			return err
+		}
+		sec := ic.currSec
+		if sec == "" {
+			sec = GLOBAL_OPTION
+		}
+		val, raw := e.value, e.value
+		if e.array {
+			if p.arrays[sec][e.key] {
+				old, _ := ic.ValFrom(e.key, sec)
+				val, raw = old+","+val, ic.raws[sec][e.key].raw+","+raw
+			} else {
+				mark(p.arrays, sec, e.key)
+			}
+		}
+		ic.bind(e.key, val)
+		if ic.raws[sec] == nil {
+			ic.raws[sec] = make(map[string]*iniRaw)
+		}
+		ic.raws[sec][e.key] = &iniRaw{raw: raw, included: p.including > 0}
+		mark(p.raws, sec, e.key)
+		p.addLine(iniLine{key: e.key, comment: e.comment})
+		mark(p.bound, sec, e.key)
 	}
-	return ic
+	return nil
 }
 
-// SectionVals return all key-value pairs from section
-func (ic *iniConfig) SectionVals(section string) map[string]string {
-	return ic.values[section]
+// mark set key of section to true
+func mark(m map[string]map[string]bool, sec, key string) {
+	if m[sec] == nil {
+		m[sec] = make(map[string]bool)
+	}
+	m[sec][key] = true
 }
 
-// SetSectionVals set section vlaues
-func (ic *iniConfig) SetSectionVals(section string, values map[string]string) {
-	ic.values[section] = values
+// errorAt convert error of logical line to ParseError
+func (p *iniParser) errorAt(l *logicalLine, err *lineError) error {
+	var file string
+	if len(p.files) > 0 {
+		file = p.files[len(p.files)-1]
+	}
+	line, col := l.pos(err.offset)
+	return &ParseError{File: file, Line: line, Column: col, Msg: err.msg}
 }
 
-// bind bind key-value to current section
-func (ic *iniConfig) bind(key, value string) {
-	if ic.currSec == "" {
-		ic.addSection(GLOBAL_OPTION).SetCurrSec(GLOBAL_OPTION)
+// addLine add line to layout of current section, lines of included files are
+// ignored
+func (p *iniParser) addLine(line iniLine) {
+	if p.including > 0 {
+		return
 	}
-	ic.SectionVals(ic.CurrSec())[key] = value
+	sec := p.ic.currSec
+	if sec == "" {
+		sec = GLOBAL_OPTION
+	}
+	lay := p.ic.layoutSection(sec)
+	lay.lines = append(lay.lines, line)
 }
 
 // lineType is parse result of per line
 type lineType int8
 
 const (
-	_SECTION   lineType = iota // section : [section]
-	_KV                        // key-value : key=value
-	_BLANK                     // blank line or comment : #comment
-	_ERRFORMAT                 // error format line : [section, =value ...
+	_SECTION  lineType = iota // section : [section]
+	_KV                       // key-value : key=value
+	_BLANK                    // blank line or comment : #comment
+	_CONTINUE                 // line end with backslash : key=value \
 )
 
-// parse read and parse from a reader
-func (ic *iniConfig) parse(reader io.Reader) (err error) {
-	err = sys.FilterLine(reader, func(linenum int, line []byte) error {
-		pair, result := parseLine(line)
-		switch result {
-		case _SECTION:
-			sec := pair.Key
-			ic.addSection(sec).SetCurrSec(sec)
-		case _KV:
-			ic.bind(pair.Key, pair.Value)
-		case _ERRFORMAT:
-			return Errorf("Wrong format of line %d: %s", linenum, string(line))
-		}
-		return nil
-	})
-	if err == nil {
-		ic.SetCurrSec(ic.DefSec())
+// iniEntry is a parsed logical line
+type iniEntry struct {
+	typ     lineType
+	key     string // key or section name
+	value   string
+	array   bool   // key[]=value
+	comment string // trailing comment, for blank line or comment line, it's the whole line
+}
+
+// lineError is an error at offset of logical line
+type lineError struct {
+	offset int
+	msg    string
+}
+
+// logicalLine is a line joined from physical lines end with backslash,
+// positions of physical lines are kept for error reporting
+type logicalLine struct {
+	text  string
+	parts []linePart
+}
+
+// linePart is a physical line of logical line
+type linePart struct {
+	offset int // offset in logical line
+	line   int
+	col    int // column of first character
+}
+
+// add append a physical line, trailing spaces are removed, for continued
+// line, leading spaces are also removed
+func (l *logicalLine) add(linenum int, line string) {
+	col := 1
+	if len(l.parts) > 0 {
+		trimmed := strings.TrimLeft(line, " \t")
+		col += len(line) - len(trimmed)
+		line = trimmed
+	}
+	l.parts = append(l.parts, linePart{offset: len(l.text), line: linenum, col: col})
+	l.text += strings.TrimRight(line, " \t")
+}
+
+// reset clear logical line for next line
+func (l *logicalLine) reset() {
+	l.text, l.parts = "", l.parts[:0]
+}
+
+// pos return line and column of offset
+func (l *logicalLine) pos(offset int) (line, col int) {
+	part := l.parts[0]
+	for _, p := range l.parts[1:] {
+		if p.offset > offset {
+			break
+		}
+		part = p
+	}
+	return part.line, part.col + offset - part.offset
+}
+
+// parseLine parse a logical ini line, comment line start with # or ;,
+// for [section], name returned by key, for key=value, value may be:
+// unquoted: end at #, \# is a literal #, spaces around are trimmed
+// double quoted: may contains # and ;, escape sequences \\ \" \' \n \r \t \# \;
+// are supported
+// single quoted or back quoted: may contains # and ;, no escape sequences
+// empty value must be quoted, for key[]=value, array is true, a trailing
+// backslash of unquoted or double quoted value continue the line
+func parseLine(s string) (e iniEntry, err *lineError) {
+	i := skipSpaces(s, 0)
+	switch {
+	case i == len(s):
+		e.typ = _BLANK
+	case s[i] == '#' || s[i] == ';':
+		e.typ, e.comment = _BLANK, s[i:]
+	case s[i] == '[':
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return e, &lineError{len(s), "missing ]"}
+		}
+		if e.key = strings.TrimSpace(s[i+1 : end]); e.key == "" {
+			return e, &lineError{i + 1, "empty section name"}
+		}
+		e.typ = _SECTION
+		e.comment, err = trailingComment(s, end+1)
+	default:
+		e.typ = _KV
+		err = parseKV(s, i, &e)
 	}
 	return
 }
 
-// parseLine parse ini file line,
-// for [section], name returned by key
-// for key=value, return key, value
-// result represent the line is Section, normal key-value, blank, comment, error
-func parseLine(line []byte) (pair *types.Pair, result lineType) {
-	line = types.TrimBytesAfter(line, []byte("#"))
-	if len(line) == 0 {
-		result = _BLANK
-		return
+// parseKV parse key-value start at i
+func parseKV(s string, i int, e *iniEntry) *lineError {
+	eq := strings.IndexAny(s, "=#")
+	if eq < 0 || s[eq] == '#' {
+		end := len(s)
+		if eq >= 0 {
+			end = eq
+		}
+		return &lineError{len(strings.TrimRight(s[:end], " \t")), "missing ="}
 	}
-	pair = types.ParsePair(string(line), "=")
-	if pair.TrimQuote() != nil || pair.NoKey() {
-		result = _ERRFORMAT
-	} else {
-		key := pair.Key
-		if key[0] == '[' {
-			last := len(key) - 1
-			if key[last] == ']' {
-				pair.Key = key[1:last]
-				result = _SECTION
-			} else {
-				result = _ERRFORMAT
+	key := strings.TrimSpace(s[i:eq])
+	if strings.HasSuffix(key, "[]") {
+		key, e.array = strings.TrimSpace(key[:len(key)-2]), true
+	}
+	if key == "" {
+		return &lineError{i, "missing key"}
+	}
+	e.key = key
+	i = skipSpaces(s, eq+1)
+	if i == len(s) || s[i] == '#' {
+		return &lineError{i, "missing value, empty value must be quoted"}
+	}
+	switch c := s[i]; c {
+	case '"':
+		return parseQuoted(s, i, e)
+	case '\'', '`':
+		end := strings.IndexByte(s[i+1:], c)
+		if end < 0 {
+			return &lineError{i, "unclosed quote"}
+		}
+		end += i + 1
+		var err *lineError
+		e.value = s[i+1 : end]
+		e.comment, err = trailingComment(s, end+1)
+		return err
+	}
+	return parseUnquoted(s, i, e)
+}
+
+// parseQuoted parse double quoted value start at i
+func parseQuoted(s string, i int, e *iniEntry) *lineError {
+	var buf bytes.Buffer
+	for j := i + 1; j < len(s); j++ {
+		switch c := s[j]; c {
+		case '"':
+			var err *lineError
+			e.value = buf.String()
+			e.comment, err = trailingComment(s, j+1)
+			return err
+		case '\\':
+			if j+1 == len(s) {
+				e.typ = _CONTINUE
+				return nil
 			}
-		} else {
-			if pair.NoValue() {
-				result = _ERRFORMAT
-			} else {
-				result = _KV
+			j++
+			switch c = s[j]; c {
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case '\\', '"', '\'', '#', ';':
+				buf.WriteByte(c)
+			default:
+				return &lineError{j - 1, "unknown escape sequence \\" + string(c)}
 			}
+		default:
+			buf.WriteByte(c)
 		}
 	}
-	return
+	return &lineError{i, "unclosed quote"}
+}
+
+// parseUnquoted parse unquoted value start at i
+func parseUnquoted(s string, i int, e *iniEntry) *lineError {
+	var buf bytes.Buffer
+	for j := i; j < len(s); j++ {
+		switch c := s[j]; {
+		case c == '#':
+			e.comment = s[j:]
+			e.value = strings.TrimRight(buf.String(), " \t")
+			return nil
+		case c == '\\' && j+1 == len(s):
+			e.typ = _CONTINUE
+			return nil
+		case c == '\\' && s[j+1] == '#':
+			buf.WriteByte('#')
+			j++
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	e.value = buf.String()
+	return nil
+}
+
+// trailingComment return comment after position i, only spaces and comment
+// are allowed
+func trailingComment(s string, i int) (string, *lineError) {
+	i = skipSpaces(s, i)
+	switch {
+	case i == len(s):
+		return "", nil
+	case s[i] == '#' || s[i] == ';':
+		return s[i:], nil
+	}
+	return "", &lineError{i, "unexpected " + strconv.Quote(s[i:i+1])}
+}
+
+// skipSpaces return index of first non-space character from i
+func skipSpaces(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// isQuote check whether character is a quote character
+func isQuote(c byte) bool {
+	return c == '\'' || c == '"' || c == '`'
+}
+
+// iniQuote quote value if it can't be written as is, quoted value use double
+// quote and escape sequences
+func iniQuote(val string) string {
+	if val != "" && types.TrimSpace(val) == val && !isQuote(val[0]) &&
+		!strings.ContainsAny(val, "#\n\r") && !strings.HasSuffix(val, "\\") {
+		return val
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for i := 0; i < len(val); i++ {
+		switch c := val[i]; c {
+		case '\\', '"':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
 }
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	. "github.com/cosiner/gohper/lib/errors"
+)
+
+// interpolate expand variables in values bound by parser,
+// ${section.key} is replaced by value of key in section, ${NAME} is replaced
+// by environment variable, ${NAME:-default} use default when variable is not
+// exist or empty, $$ is a literal $
+func (p *iniParser) interpolate() error {
+	resolving := make(map[string]bool)
+	for sec, keys := range p.bound {
+		for key := range keys {
+			if _, err := p.resolve(sec, key, resolving); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve expand value of key in section if it's bound in this parsing and not
+// expanded, expanded value is saved back to config
+func (p *iniParser) resolve(sec, key string, resolving map[string]bool) (string, error) {
+	val := p.ic.values[sec][key]
+	if !p.bound[sec][key] {
+		return val, nil
+	}
+	name := sec + "." + key
+	if resolving[name] {
+		return "", Errorf("Interpolation cycle at ${%s}", name)
+	}
+	resolving[name] = true
+	val, err := p.expand(val, resolving)
+	delete(resolving, name)
+	if err == nil {
+		p.ic.values[sec][key] = val
+		delete(p.bound[sec], key)
+	}
+	return val, err
+}
+
+// expand replace all variables in string
+func (p *iniParser) expand(s string, resolving map[string]bool) (string, error) {
+	if strings.IndexByte(s, '$') < 0 {
+		return s, nil
+	}
+	var buf bytes.Buffer
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 {
+			buf.WriteString(s)
+			return buf.String(), nil
+		}
+		buf.WriteString(s[:i])
+		s = s[i:]
+		switch {
+		case strings.HasPrefix(s, "$$"):
+			buf.WriteByte('$')
+			s = s[2:]
+		case strings.HasPrefix(s, "${"):
+			end := closeBrace(s)
+			if end < 0 {
+				return "", Errorf("Unclosed variable: %s", s)
+			}
+			val, err := p.variable(s[2:end], resolving)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(val)
+			s = s[end+1:]
+		default:
+			buf.WriteByte('$')
+			s = s[1:]
+		}
+	}
+}
+
+// closeBrace return index of the brace close the first ${, nested variables
+// in default value are skipped
+func closeBrace(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// variable return value of variable, the name may have a default value like
+// NAME:-default
+func (p *iniParser) variable(name string, resolving map[string]bool) (string, error) {
+	var def string
+	i := strings.Index(name, ":-")
+	hasDef := i >= 0
+	if hasDef {
+		name, def = name[:i], name[i+2:]
+	}
+	val, has, err := p.lookup(name, resolving)
+	if err != nil || (has && val != "") || !hasDef {
+		if err == nil && !has {
+			err = Errorf("Undefined variable: ${%s}", name)
+		}
+		return val, err
+	}
+	return p.expand(def, resolving)
+}
+
+// lookup find variable as section.key from config first, then environment
+func (p *iniParser) lookup(name string, resolving map[string]bool) (string, bool, error) {
+	if i := strings.LastIndexByte(name, '.'); i > 0 {
+		sec, key := name[:i], name[i+1:]
+		if _, has := p.ic.ValFrom(key, sec); has {
+			val, err := p.resolve(sec, key, resolving)
+			return val, true, err
+		}
+	}
+	val, has := os.LookupEnv(name)
+	return val, has, nil
+}
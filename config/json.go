@@ -0,0 +1,132 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	. "github.com/cosiner/gohper/lib/errors"
+	"github.com/cosiner/gohper/lib/sys"
+	"github.com/cosiner/gohper/lib/types"
+)
+
+// jsonConfig parse json object, members of top-level object are in global
+// section, nested objects are sections named by their key, deeper nested
+// objects are sections named by dotted path like db.replica, arrays of scalar
+// values are joined by comma, other arrays are kept as json
+type jsonConfig struct {
+	sectionValues
+}
+
+// newJSONConfig return a json config parser
+func newJSONConfig() ConfigParser {
+	return &jsonConfig{
+		sectionValues: newSectionValues(),
+	}
+}
+
+// ParseString parse from string
+func (jc *jsonConfig) ParseString(content string) error {
+	if content == "" {
+		return ErrNoContent
+	}
+	return jc.parse(types.StringReader(content))
+}
+
+// ParseFile parse from file
+func (jc *jsonConfig) ParseFile(confFileName string) error {
+	return sys.OpenForRead(confFileName, func(fd *os.File) error {
+		return jc.parse(fd)
+	})
+}
+
+// parse read and parse json object from reader
+func (jc *jsonConfig) parse(reader io.Reader) error {
+	var obj json.RawMessage
+	dec := json.NewDecoder(reader)
+	err := dec.Decode(&obj)
+	if err == nil {
+		err = jc.parseObject(obj, "")
+	}
+	if err == nil {
+		jc.SetCurrSec(jc.DefSec())
+	}
+	return err
+}
+
+// parseObject parse members of object to section, member order is kept
+func (jc *jsonConfig) parseObject(obj json.RawMessage, section string) error {
+	dec := json.NewDecoder(bytes.NewReader(obj))
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return Errorf("Expect json object for section %s", section)
+	}
+	if section != "" {
+		jc.addSection(section).SetCurrSec(section)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return err
+		}
+		switch raw[0] {
+		case '{':
+			err = jc.parseObject(raw, subSection(section, key))
+		case '[':
+			var val string
+			if val, err = jsonArray(raw); err == nil {
+				jc.bindTo(section, key, val)
+			}
+		default:
+			var val string
+			if val, err = jsonScalar(raw); err == nil {
+				jc.bindTo(section, key, val)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonScalar convert json string, number, bool or null to string, numbers
+// are kept as written, null is empty string
+func jsonScalar(raw json.RawMessage) (string, error) {
+	if raw[0] != '"' {
+		if bytes.Equal(raw, []byte("null")) {
+			return "", nil
+		}
+		return string(raw), nil
+	}
+	var s string
+	err := json.Unmarshal(raw, &s)
+	return s, err
+}
+
+// jsonArray join scalar elements of array by comma, if there is non-scalar
+// element, compacted json is returned
+func jsonArray(raw json.RawMessage) (string, error) {
+	var elems []json.RawMessage
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		return "", err
+	}
+	vals := make([]string, len(elems))
+	for i, e := range elems {
+		if e[0] == '{' || e[0] == '[' {
+			var buf bytes.Buffer
+			err := json.Compact(&buf, raw)
+			return buf.String(), err
+		}
+		vals[i], _ = jsonScalar(e)
+	}
+	return strings.Join(vals, ","), nil
+}
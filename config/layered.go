@@ -0,0 +1,220 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Source is where a value of layered config come from
+type Source int8
+
+const (
+	// SOURCE_FILE means value come from parsed file
+	SOURCE_FILE Source = iota
+	// SOURCE_ENV means value come from environment variable
+	SOURCE_ENV
+	// SOURCE_FLAG means value come from command line flag
+	SOURCE_FLAG
+)
+
+func (s Source) String() (str string) {
+	switch s {
+	case SOURCE_FILE:
+		str = "file"
+	case SOURCE_ENV:
+		str = "env"
+	case SOURCE_FLAG:
+		str = "flag"
+	}
+	return
+}
+
+// Layered is a ConfigParser that resolve a key from command line flags like
+// --section.key=value first, then environment variables like
+// PREFIX_SECTION_KEY, then the underlying parser, flags without section like
+// --key=value and environment variables without section like PREFIX_KEY are
+// for the global section, parsing and section setting are delegated to the
+// underlying parser
+type Layered struct {
+	ConfigParser
+	envPrefix string
+	flags     map[string]map[string]string // section to key-values
+}
+
+// NewLayered create a layered config over parser, args are command line
+// arguments like os.Args[1:], only arguments like --section.key=value and
+// --section.key are used, the later is value true, arguments after -- are
+// ignored, environment variables are prefixed with envPrefix and underscore,
+// if envPrefix is empty, no prefix
+func NewLayered(parser ConfigParser, envPrefix string, args []string) *Layered {
+	l := &Layered{
+		ConfigParser: parser,
+		envPrefix:    envPrefix,
+		flags:        make(map[string]map[string]string),
+	}
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		arg = arg[2:]
+		name, val := arg, "true"
+		if i := strings.IndexByte(arg, '='); i >= 0 {
+			name, val = arg[:i], arg[i+1:]
+		}
+		section := GLOBAL_OPTION
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			section, name = name[:i], name[i+1:]
+		}
+		if name == "" {
+			continue
+		}
+		if l.flags[section] == nil {
+			l.flags[section] = make(map[string]string)
+		}
+		l.flags[section][name] = val
+	}
+	return l
+}
+
+// isGlobal check whether section is the global section
+func isGlobal(section string) bool {
+	return section == "" || section == GLOBAL_OPTION
+}
+
+// flag return value of key from command line flags
+func (l *Layered) flag(key, section string) (string, bool) {
+	if isGlobal(section) {
+		section = GLOBAL_OPTION
+	}
+	val, has := l.flags[section][key]
+	return val, has
+}
+
+// EnvName return name of environment variable for key in section, name is
+// upper case, characters except letters and digits are replaced by underscore
+func (l *Layered) EnvName(key, section string) string {
+	var parts []string
+	if l.envPrefix != "" {
+		parts = append(parts, l.envPrefix)
+	}
+	if !isGlobal(section) {
+		parts = append(parts, section)
+	}
+	parts = append(parts, key)
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, strings.Join(parts, "_"))
+}
+
+// Lookup return value of key in section and where it come from
+func (l *Layered) Lookup(key, section string) (val string, src Source, has bool) {
+	if val, has = l.flag(key, section); has {
+		return val, SOURCE_FLAG, true
+	}
+	if val, has = os.LookupEnv(l.EnvName(key, section)); has {
+		return val, SOURCE_ENV, true
+	}
+	val, has = l.ConfigParser.ValFrom(key, section)
+	return val, SOURCE_FILE, has
+}
+
+// ValFrom return value from section with gived key
+func (l *Layered) ValFrom(key, section string) (string, bool) {
+	val, _, has := l.Lookup(key, section)
+	return val, has
+}
+
+// HasSection check whether section exist in underlying parser or flags
+func (l *Layered) HasSection(section string) bool {
+	return l.ConfigParser.HasSection(section) || l.flags[section] != nil
+}
+
+// keys return all keys of section in underlying parser and flags
+func (l *Layered) keys(section string) map[string]bool {
+	keys := make(map[string]bool)
+	if l.ConfigParser.HasSection(section) {
+		for k := range l.ConfigParser.SectionVals(section) {
+			keys[k] = true
+		}
+	}
+	if isGlobal(section) {
+		section = GLOBAL_OPTION
+	}
+	for k := range l.flags[section] {
+		keys[k] = true
+	}
+	return keys
+}
+
+// SectionVals return a copy of resolved key-value pairs of section, only keys
+// exist in underlying parser or flags are included, modification of returned
+// map don't affect config
+func (l *Layered) SectionVals(section string) map[string]string {
+	keys := l.keys(section)
+	if len(keys) == 0 && !l.HasSection(section) {
+		return nil
+	}
+	vals := make(map[string]string, len(keys))
+	for k := range keys {
+		vals[k], _ = l.ValFrom(k, section)
+	}
+	return vals
+}
+
+// Sections return all section names of underlying parser and flags
+func (l *Layered) Sections() []string {
+	sections := Sections(l.ConfigParser)
+	has := make(map[string]bool, len(sections))
+	for _, sec := range sections {
+		has[sec] = true
+	}
+	for sec := range l.flags {
+		if !has[sec] {
+			sections = append(sections, sec)
+		}
+	}
+	sort.Strings(sections)
+	return sections
+}
+
+// WriteReport write all effective values and where they come from, sections
+// and keys are sorted
+func (l *Layered) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, sec := range l.Sections() {
+		keys := l.keys(sec)
+		names := make([]string, 0, len(keys))
+		for k := range keys {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(tw, "[%s]\n", sec)
+		for _, k := range names {
+			val, src, _ := l.Lookup(k, sec)
+			var from string
+			switch src {
+			case SOURCE_FLAG:
+				from = "flag --" + subSection(sec, k)
+			case SOURCE_ENV:
+				from = "env " + l.EnvName(k, sec)
+			default:
+				from = "file"
+			}
+			fmt.Fprintf(tw, "%s\t= %s\t(%s)\n", k, quoteValue(val), from)
+		}
+	}
+	return tw.Flush()
+}
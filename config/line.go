@@ -1,6 +1,8 @@
 package config
 
 import (
+	"io"
+	"sort"
 	"strings"
 
 	"github.com/cosiner/gohper/lib/sys"
@@ -14,6 +16,7 @@ import (
 // there is no different section
 type lineConfig struct {
 	values map[string]string
+	keys   []string // keys in parsed order, for writing back
 }
 
 // NewLineConfig return a line config parser
@@ -35,6 +38,9 @@ func (lc *lineConfig) ParseString(str string) (err error) {
 					break
 				}
 			} else {
+				if _, has := lc.values[pair.Key]; !has {
+					lc.keys = append(lc.keys, pair.Key)
+				}
 				lc.values[pair.Key] = pair.Value
 			}
 		}
@@ -76,6 +82,11 @@ func (lc *lineConfig) HasSection(section string) bool {
 	return true
 }
 
+// Sections return the only section name, it's empty
+func (lc *lineConfig) Sections() []string {
+	return []string{""}
+}
+
 // SectionVals return all key-value pairs from section
 func (lc *lineConfig) SectionVals(section string) map[string]string {
 	return lc.values
@@ -85,3 +96,40 @@ func (lc *lineConfig) SectionVals(section string) map[string]string {
 func (lc *lineConfig) SetSectionVals(section string, values map[string]string) {
 	lc.values = values
 }
+
+// WriteTo write config to writer in line format, parsed keys keep their order,
+// others are sorted and appended, value contains & or newline can't be written
+func (lc *lineConfig) WriteTo(w io.Writer) (int64, error) {
+	keys := make([]string, 0, len(lc.values))
+	written := make(map[string]bool, len(lc.values))
+	for _, key := range lc.keys {
+		if _, has := lc.values[key]; has && !written[key] {
+			keys = append(keys, key)
+			written[key] = true
+		}
+	}
+	added := make([]string, 0, len(lc.values)-len(keys))
+	for key := range lc.values {
+		if !written[key] {
+			added = append(added, key)
+		}
+	}
+	sort.Strings(added)
+	keys = append(keys, added...)
+
+	fields := make([]string, len(keys))
+	for i, key := range keys {
+		val := lc.values[key]
+		if strings.ContainsAny(val, "&\n") {
+			return 0, Errorf("Can't write value of %s in line format: %s", key, val)
+		}
+		fields[i] = key + "=" + quoteValue(val)
+	}
+	n, err := io.WriteString(w, strings.Join(fields, "&"))
+	return int64(n), err
+}
+
+// SaveFile write config to file in line format
+func (lc *lineConfig) SaveFile(fname string) error {
+	return saveFile(lc, fname)
+}
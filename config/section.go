@@ -0,0 +1,106 @@
+package config
+
+import "sort"
+
+// sectionValues store values of sections, it's shared by parsers of formats
+// that have sections
+type sectionValues struct {
+	currSec string // current section
+	defSec  string
+	values  map[string]map[string]string // values : [section]([key]value)
+}
+
+// newSectionValues return an empty section values
+func newSectionValues() sectionValues {
+	return sectionValues{
+		values: make(map[string]map[string]string),
+	}
+}
+
+// ValFrom return value from section with gived key
+func (sv *sectionValues) ValFrom(key, section string) (val string, has bool) {
+	var vals map[string]string
+	if vals, has = sv.values[section]; has {
+		val, has = vals[key]
+	}
+	return
+}
+
+// DefSec return first section of config
+func (sv *sectionValues) DefSec() string {
+	return sv.defSec
+}
+
+// CurrSec return current section
+func (sv *sectionValues) CurrSec() string {
+	return sv.currSec
+}
+
+// SetCurrSec set current section
+func (sv *sectionValues) SetCurrSec(section string) {
+	if section != "" {
+		sv.currSec = section
+		if sv.defSec == "" {
+			sv.defSec = section
+		}
+	}
+}
+
+// HasSection check whether given section exist in config
+func (sv *sectionValues) HasSection(section string) bool {
+	return sv.values[section] != nil
+}
+
+// addsection prepare space for new section if section not exist
+func (sv *sectionValues) addSection(section string) *sectionValues {
+	if !sv.HasSection(section) {
+		sv.values[section] = make(map[string]string)
+	}
+	return sv
+}
+
+// Sections return all section names in sorted order
+func (sv *sectionValues) Sections() []string {
+	sections := make([]string, 0, len(sv.values))
+	for sec := range sv.values {
+		sections = append(sections, sec)
+	}
+	sort.Strings(sections)
+	return sections
+}
+
+// SectionVals return all key-value pairs from section
+func (sv *sectionValues) SectionVals(section string) map[string]string {
+	return sv.values[section]
+}
+
+// SetSectionVals set section vlaues
+func (sv *sectionValues) SetSectionVals(section string, values map[string]string) {
+	sv.values[section] = values
+}
+
+// bind bind key-value to current section
+func (sv *sectionValues) bind(key, value string) {
+	if sv.currSec == "" {
+		sv.addSection(GLOBAL_OPTION).SetCurrSec(GLOBAL_OPTION)
+	}
+	sv.SectionVals(sv.CurrSec())[key] = value
+}
+
+// bindTo bind key-value to section, if section is empty, bind to global
+// section, the first section bound to is the default section
+func (sv *sectionValues) bindTo(section, key, value string) {
+	if section == "" {
+		section = GLOBAL_OPTION
+	}
+	sv.addSection(section).SetCurrSec(section)
+	sv.values[section][key] = value
+}
+
+// subSection return name of child section, nested sections are joined by dot
+func subSection(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	. "github.com/cosiner/gohper/lib/errors"
+	"github.com/cosiner/gohper/lib/sys"
+	"github.com/cosiner/gohper/lib/types"
+)
+
+// tomlConfig parse a subset of toml, keys before any table are in global
+// section, tables are sections, dotted keys like a.b=1 are key b of section
+// a under current table, basic and literal strings, numbers, booleans, dates
+// and single line arrays are supported, arrays are joined by comma, multi-line
+// strings, inline tables and array of tables are not supported
+type tomlConfig struct {
+	sectionValues
+}
+
+// newTOMLConfig return a toml config parser
+func newTOMLConfig() ConfigParser {
+	return &tomlConfig{
+		sectionValues: newSectionValues(),
+	}
+}
+
+// ParseString parse from string
+func (tc *tomlConfig) ParseString(content string) error {
+	if content == "" {
+		return ErrNoContent
+	}
+	return tc.parse(types.StringReader(content))
+}
+
+// ParseFile parse from file
+func (tc *tomlConfig) ParseFile(confFileName string) error {
+	return sys.OpenForRead(confFileName, func(fd *os.File) error {
+		return tc.parse(fd)
+	})
+}
+
+// parse read and parse from a reader
+func (tc *tomlConfig) parse(reader io.Reader) error {
+	var table string
+	err := sys.FilterLine(reader, func(linenum int, line []byte) error {
+		l := strings.TrimSpace(string(line))
+		switch {
+		case l == "" || l[0] == '#':
+		case strings.HasPrefix(l, "[["):
+			return Errorf("Array of tables is not supported at line %d: %s", linenum, l)
+		case l[0] == '[':
+			end := strings.IndexByte(l, ']')
+			if end < 0 || !isTOMLComment(l[end+1:]) {
+				return Errorf("Wrong format of line %d: %s", linenum, l)
+			}
+			table = tomlKey(l[1:end])
+			tc.addSection(table).SetCurrSec(table)
+		default:
+			eq := strings.IndexByte(l, '=')
+			if eq <= 0 {
+				return Errorf("Wrong format of line %d: %s", linenum, l)
+			}
+			key := tomlKey(l[:eq])
+			val, err := tomlValue(strings.TrimSpace(l[eq+1:]))
+			if err != nil {
+				return Errorf("Wrong format of line %d: %s, %s", linenum, l, err.Error())
+			}
+			section := table
+			if dot := strings.LastIndexByte(key, '.'); dot > 0 {
+				section, key = subSection(table, key[:dot]), key[dot+1:]
+			}
+			tc.bindTo(section, key, val)
+		}
+		return nil
+	})
+	if err == nil {
+		tc.SetCurrSec(tc.DefSec())
+	}
+	return err
+}
+
+// tomlKey normalize key or table name, spaces around dots and quotes of
+// each part are removed
+func tomlKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, p := range parts {
+		parts[i], _ = types.TrimQuote(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// isTOMLComment check whether string is empty or a comment
+func isTOMLComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
+
+// tomlValue parse value and trailing comment, return value as string
+func tomlValue(s string) (string, error) {
+	val, rest, err := tomlScalar(s)
+	if err == nil && !isTOMLComment(rest) {
+		err = Errorf("unexpected %s", rest)
+	}
+	return val, err
+}
+
+// tomlScalar parse a value at the beginning of string, return the value and
+// rest of string
+func tomlScalar(s string) (val, rest string, err error) {
+	if s == "" {
+		return "", "", Errorf("missing value")
+	}
+	switch s[0] {
+	case '"':
+		if strings.HasPrefix(s, `"""`) {
+			return "", "", Errorf("multi-line string is not supported")
+		}
+		end := 1
+		for ; end < len(s) && s[end] != '"'; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(s) {
+			return "", "", Errorf("unclosed string")
+		}
+		val, err = strconv.Unquote(s[:end+1])
+		return val, s[end+1:], err
+	case '\'':
+		if strings.HasPrefix(s, "'''") {
+			return "", "", Errorf("multi-line string is not supported")
+		}
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", Errorf("unclosed string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	case '[':
+		return tomlArray(s)
+	case '{':
+		return "", "", Errorf("inline table is not supported")
+	}
+	end := strings.IndexAny(s, ",]#")
+	if end < 0 {
+		end = len(s)
+	}
+	val = strings.TrimSpace(s[:end])
+	switch n := strings.Replace(val, "_", "", -1); {
+	case val == "true" || val == "false":
+	case isTOMLNumber(n):
+		val = n // 1_000 is 1000
+	case val != "" && val[0] >= '0' && val[0] <= '9' && strings.ContainsAny(val, "-:"): // date or time
+	default:
+		return "", "", Errorf("invalid value %s", val)
+	}
+	return val, s[end:], nil
+}
+
+// isTOMLNumber check whether string is a integer or float
+func isTOMLNumber(s string) bool {
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return true
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// tomlArray parse a single line array, elements are joined by comma
+func tomlArray(s string) (val, rest string, err error) {
+	var elems []string
+	s = strings.TrimSpace(s[1:])
+	for !strings.HasPrefix(s, "]") {
+		var elem string
+		if elem, s, err = tomlScalar(s); err != nil {
+			return
+		}
+		elems = append(elems, elem)
+		if s = strings.TrimSpace(s); strings.HasPrefix(s, ",") {
+			s = strings.TrimSpace(s[1:])
+		} else if !strings.HasPrefix(s, "]") {
+			return "", "", Errorf("unclosed array")
+		}
+	}
+	return strings.Join(elems, ","), s[1:], nil
+}
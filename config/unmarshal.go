@@ -0,0 +1,262 @@
+package config
+
+import (
+	"encoding"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/cosiner/gohper/lib/errors"
+	"github.com/cosiner/gohper/lib/types"
+)
+
+// UnmarshalErrors is all errors occurred when unmarshal config to struct
+type UnmarshalErrors []error
+
+func (e UnmarshalErrors) Error() string {
+	errs := make([]string, len(e))
+	for i, err := range e {
+		errs[i] = err.Error()
+	}
+	return strings.Join(errs, "; ")
+}
+
+// fieldTag is parsed struct tag like `config:"name,default=10,required,bytes"`
+type fieldTag struct {
+	name     string
+	def      string
+	hasDef   bool
+	required bool
+	bytes    bool // parse value as byte size like 10M
+}
+
+// parseFieldTag parse config tag of field, if name is not specified, it's
+// empty, if tag is "-", false is returned
+func parseFieldTag(field reflect.StructField) (tag fieldTag, ok bool) {
+	s := field.Tag.Get("config")
+	if s == "-" {
+		return tag, false
+	}
+	opts := strings.Split(s, ",")
+	tag.name = strings.TrimSpace(opts[0])
+	for i := 1; i < len(opts); i++ {
+		opt := strings.TrimSpace(opts[i])
+		switch {
+		case opt == "required":
+			tag.required = true
+		case opt == "bytes":
+			tag.bytes = true
+		case strings.HasPrefix(opt, "default="):
+			// default value may contains comma, like default=a,b
+			tag.def, tag.hasDef = strings.Join(append([]string{opt[len("default="):]}, opts[i+1:]...), ","), true
+			i = len(opts)
+		}
+	}
+	return tag, true
+}
+
+// UnmarshalSection unmarshal values of section to struct v point to, key of
+// field is specified by tag `config:"name,default=10,required"`, if no name,
+// it's the key equal to field name case insensitively, field tagged "-" is
+// skipped, supported field types are string, bool, numbers, time.Duration,
+// []string of comma separated values, types implement encoding.TextUnmarshaler,
+// integers tagged with bytes option are parsed by types.Str2Bytes like 10M,
+// nested struct is bind to sub-section named section.name, for global section,
+// sub-section is named name, missing required keys and wrong values are
+// aggregated as UnmarshalErrors
+func (c *Config) UnmarshalSection(section string, v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return Errorf("Non-pointer of struct type: %s", value.Type())
+	}
+	u := unmarshaler{c: c, sections: make(map[string]bool)}
+	for _, sec := range Sections(c.ConfigParser) {
+		u.sections[sec] = true
+	}
+	u.unmarshal(section, value.Elem())
+	if len(u.errs) == 0 {
+		return nil
+	}
+	return u.errs
+}
+
+// UnmarshalCurrSec unmarshal values of current section to struct, see
+// UnmarshalSection
+func (c *Config) UnmarshalCurrSec(v interface{}) error {
+	return c.UnmarshalSection(c.CurrSec(), v)
+}
+
+// unmarshaler unmarshal sections to struct and collect errors
+type unmarshaler struct {
+	c        *Config
+	sections map[string]bool
+	errs     UnmarshalErrors
+}
+
+// unmarshal bind values of section to struct value
+func (u *unmarshaler) unmarshal(section string, value reflect.Value) {
+	var vals map[string]string
+	if u.sections[section] {
+		vals = u.c.SectionVals(section)
+	}
+	keys := make(map[string]string, len(vals)) // lower case to key
+	for k := range vals {
+		keys[strings.ToLower(k)] = k
+	}
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok := parseFieldTag(field)
+		if !ok || field.PkgPath != "" { // skipped or unexported
+			continue
+		}
+		fv := value.Field(i)
+		if isNested(fv) {
+			name := tag.name
+			if name == "" {
+				name = u.subSectionOf(section, field.Name)
+			}
+			if section != "" && section != GLOBAL_OPTION {
+				name = subSection(section, name)
+			}
+			if fv.Kind() == reflect.Ptr {
+				if !u.sections[name] && !tag.required {
+					continue
+				}
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			u.unmarshal(name, fv)
+			continue
+		}
+
+		key := tag.name
+		if key == "" {
+			if key = keys[strings.ToLower(field.Name)]; key == "" {
+				key = field.Name
+			}
+		}
+		val, has := vals[key]
+		if !has {
+			if tag.hasDef {
+				val, has = tag.def, true
+			} else if tag.required {
+				u.errs = append(u.errs, Errorf("%s: required", subSection(section, key)))
+			}
+		}
+		if has {
+			if err := setField(fv, val, tag.bytes); err != nil {
+				u.errs = append(u.errs, Errorf("%s: %s", subSection(section, key), err.Error()))
+			}
+		}
+	}
+}
+
+// subSectionOf find name of sub-section that equal to field name case
+// insensitively, if not found, field name is returned
+func (u *unmarshaler) subSectionOf(section, field string) string {
+	prefix := section + "."
+	if section == "" || section == GLOBAL_OPTION {
+		prefix = ""
+	}
+	for sec := range u.sections {
+		if strings.HasPrefix(sec, prefix) {
+			name := sec[len(prefix):]
+			if !strings.Contains(name, ".") && strings.EqualFold(name, field) {
+				return name
+			}
+		}
+	}
+	return field
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isNested check whether field is a struct or pointer to struct that should
+// be bind to sub-section
+func isNested(v reflect.Value) bool {
+	t := v.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// setField parse string and set to field
+func setField(v reflect.Value, s string, bytes bool) (err error) {
+	if v.CanAddr() {
+		if u, is := v.Addr().Interface().(encoding.TextUnmarshaler); is {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+	if v.Type() == durationType {
+		var d time.Duration
+		if d, err = time.ParseDuration(s); err == nil {
+			v.SetInt(int64(d))
+		}
+		return
+	}
+	switch k := v.Kind(); k {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		var b bool
+		if b, err = types.Str2Bool(s); err == nil {
+			v.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if bytes {
+			var u uint64
+			u, err = types.Str2Bytes(s)
+			n = int64(u)
+		} else {
+			n, err = strconv.ParseInt(s, 10, 64)
+		}
+		if err == nil {
+			if v.OverflowInt(n) {
+				err = Errorf("%s overflows %s", s, v.Type())
+			} else {
+				v.SetInt(n)
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		if bytes {
+			n, err = types.Str2Bytes(s)
+		} else {
+			n, err = strconv.ParseUint(s, 10, 64)
+		}
+		if err == nil {
+			if v.OverflowUint(n) {
+				err = Errorf("%s overflows %s", s, v.Type())
+			} else {
+				v.SetUint(n)
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(s, v.Type().Bits()); err == nil {
+			v.SetFloat(f)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return Errorf("Unsupported type: %s", v.Type())
+		}
+		strs := splitList(s, ",")
+		sv := reflect.MakeSlice(v.Type(), len(strs), len(strs))
+		for i, str := range strs {
+			sv.Index(i).SetString(str)
+		}
+		v.Set(sv)
+	default:
+		err = Errorf("Unsupported type: %s", v.Type())
+	}
+	return
+}
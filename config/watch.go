@@ -0,0 +1,279 @@
+package config
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/cosiner/gohper/lib/errors"
+)
+
+const (
+	// DEF_WATCH_INTERVAL is the default interval to check modification of
+	// watched config file
+	DEF_WATCH_INTERVAL = time.Second
+
+	ErrNotWatched = Err("Config is not created by Watch")
+)
+
+// SectionDiff is the changes of a section after config file is reloaded
+type SectionDiff struct {
+	Added   map[string]string // new keys and their values
+	Changed map[string]string // changed keys and their new values
+	Removed map[string]string // removed keys and their old values
+}
+
+// Diff is the changes of config, key is section name, only changed sections
+// are included
+type Diff map[string]*SectionDiff
+
+// Watch parse config file and return a live config, the file is parsed again
+// when it's modification time changed, and values are swapped atomically,
+// if parse failed, old values are kept, only the file itself is watched,
+// changes of included files are not detected
+func Watch(path string, typ ConfigType) (*Config, error) {
+	return WatchEvery(path, typ, DEF_WATCH_INTERVAL)
+}
+
+// WatchEvery is same as Watch, but check modification of file every interval
+func WatchEvery(path string, typ ConfigType, interval time.Duration) (*Config, error) {
+	w := &watchedParser{
+		path:  path,
+		typ:   typ,
+		close: make(chan struct{}),
+	}
+	p, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.parser.Store(parserBox{p})
+	w.currSec.Store(p.CurrSec())
+	go w.watch(interval)
+	return NewConfigWith(w), nil
+}
+
+// Subscribe register a function to be called with diff of config after watched
+// file is reloaded
+func (c *Config) Subscribe(fn func(Diff)) error {
+	w, is := c.ConfigParser.(*watchedParser)
+	if !is {
+		return ErrNotWatched
+	}
+	w.lock.Lock()
+	w.subscribers = append(w.subscribers, fn)
+	w.lock.Unlock()
+	return nil
+}
+
+// StopWatch stop watching config file, values are no longer updated
+func (c *Config) StopWatch() error {
+	w, is := c.ConfigParser.(*watchedParser)
+	if !is {
+		return ErrNotWatched
+	}
+	w.stop.Do(func() {
+		close(w.close)
+	})
+	return nil
+}
+
+// parserBox wrap parser to be stored in atomic.Value
+type parserBox struct {
+	ConfigParser
+}
+
+// watchedParser is a ConfigParser that reload config file when it's changed,
+// current section is kept across reloading, values set by SetSectionVals is
+// lost after reloading
+type watchedParser struct {
+	path    string
+	typ     ConfigType
+	modTime time.Time
+	parser  atomic.Value // parserBox
+	currSec atomic.Value // string
+	valLock sync.RWMutex // guard values of current parser and swapping
+
+	lock        sync.Mutex
+	subscribers []func(Diff)
+	stop        sync.Once
+	close       chan struct{}
+}
+
+// load parse file and record it's modification time
+func (w *watchedParser) load() (ConfigParser, error) {
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return nil, err
+	}
+	c := NewConfig(w.typ)
+	if err = c.ParseFile(w.path); err != nil {
+		return nil, err
+	}
+	w.modTime = fi.ModTime()
+	return c.ConfigParser, nil
+}
+
+// watch check modification of file every interval until stopped
+func (w *watchedParser) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if fi, err := os.Stat(w.path); err == nil && !fi.ModTime().Equal(w.modTime) {
+				w.reload()
+			}
+		case <-w.close:
+			return
+		}
+	}
+}
+
+// reload parse file again, swap parser and notify subscribers if changed
+func (w *watchedParser) reload() {
+	p, err := w.load()
+	if err != nil {
+		return
+	}
+	w.valLock.Lock()
+	old := w.current()
+	w.parser.Store(parserBox{p})
+	w.valLock.Unlock()
+	diff := diffConfig(old, p)
+	if len(diff) == 0 {
+		return
+	}
+	w.lock.Lock()
+	subscribers := w.subscribers
+	w.lock.Unlock()
+	for _, fn := range subscribers {
+		fn(diff)
+	}
+}
+
+// diffConfig compare sections of old and new config
+func diffConfig(old, cur ConfigParser) Diff {
+	diff := make(Diff)
+	sections := make(map[string]bool)
+	for _, sec := range Sections(old) {
+		sections[sec] = true
+	}
+	for _, sec := range Sections(cur) {
+		sections[sec] = true
+	}
+	for sec := range sections {
+		var oldVals, curVals map[string]string
+		if old.HasSection(sec) {
+			oldVals = old.SectionVals(sec)
+		}
+		if cur.HasSection(sec) {
+			curVals = cur.SectionVals(sec)
+		}
+		if d := diffSection(oldVals, curVals); d != nil {
+			diff[sec] = d
+		}
+	}
+	return diff
+}
+
+// diffSection compare values of a section, if there is no difference, nil
+// is returned
+func diffSection(old, cur map[string]string) *SectionDiff {
+	d := &SectionDiff{
+		Added:   make(map[string]string),
+		Changed: make(map[string]string),
+		Removed: make(map[string]string),
+	}
+	for k, v := range cur {
+		if ov, has := old[k]; !has {
+			d.Added[k] = v
+		} else if ov != v {
+			d.Changed[k] = v
+		}
+	}
+	for k, v := range old {
+		if _, has := cur[k]; !has {
+			d.Removed[k] = v
+		}
+	}
+	if len(d.Added)+len(d.Changed)+len(d.Removed) == 0 {
+		return nil
+	}
+	return d
+}
+
+// current return current parser
+func (w *watchedParser) current() ConfigParser {
+	return w.parser.Load().(parserBox).ConfigParser
+}
+
+// ParseString is not supported by watched config
+func (w *watchedParser) ParseString(content string) error {
+	return Errorf("Can't parse string to watched config")
+}
+
+// ParseFile is not supported by watched config
+func (w *watchedParser) ParseFile(confFileName string) error {
+	return Errorf("Can't parse file to watched config")
+}
+
+// SetCurrSec set current section
+func (w *watchedParser) SetCurrSec(section string) {
+	if section != "" {
+		w.currSec.Store(section)
+	}
+}
+
+// DefSec return default section name of current config
+func (w *watchedParser) DefSec() string {
+	return w.current().DefSec()
+}
+
+// CurrSec return current section name
+func (w *watchedParser) CurrSec() string {
+	return w.currSec.Load().(string)
+}
+
+// ValFrom return value from section with gived key
+func (w *watchedParser) ValFrom(key, section string) (string, bool) {
+	w.valLock.RLock()
+	defer w.valLock.RUnlock()
+	return w.current().ValFrom(key, section)
+}
+
+// HasSection check whether section exist in config
+func (w *watchedParser) HasSection(section string) bool {
+	w.valLock.RLock()
+	defer w.valLock.RUnlock()
+	return w.current().HasSection(section)
+}
+
+// SectionVals return a copy of all key-value pairs from section
+func (w *watchedParser) SectionVals(section string) map[string]string {
+	w.valLock.RLock()
+	defer w.valLock.RUnlock()
+	vals := w.current().SectionVals(section)
+	if vals == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(vals))
+	for k, v := range vals {
+		copied[k] = v
+	}
+	return copied
+}
+
+// SetSectionVals set section values of current config
+func (w *watchedParser) SetSectionVals(section string, values map[string]string) {
+	w.valLock.Lock()
+	w.current().SetSectionVals(section, values)
+	w.valLock.Unlock()
+}
+
+// Sections return all section names of current config
+func (w *watchedParser) Sections() []string {
+	w.valLock.RLock()
+	defer w.valLock.RUnlock()
+	return Sections(w.current())
+}
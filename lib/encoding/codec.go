@@ -174,7 +174,7 @@ func (prw powerRW) ReadGOB(v interface{}) error {
 
 // GOBEncode encode parameter value to bytes use gob encoder
 func GOBEncode(v interface{}) (res []byte, err error) {
-	buffer := bytes.NewBuffer(make([]byte, 100))
+	buffer := bytes.NewBuffer(make([]byte, 0, 100))
 	encoder := gob.NewEncoder(buffer)
 	if err = encoder.Encode(v); err == nil {
 		res = buffer.Bytes()
@@ -15,13 +15,18 @@ const (
 	GBYTE_BASE = BYTE_BASE * MBYTE_BASE
 	TBYTE_BASE = BYTE_BASE * GBYTE_BASE
 	PBYTE_BASE = BYTE_BASE * TBYTE_BASE
+
+	ErrEmptySize = Err("Empty byte size")
 )
 
 // Str2Bytes convert byte count string to integer
-// such as: 1K/k -> 1024, 1M/m -> 1024*1024
+// such as: 1K/k -> 1024, 1M/m -> 1024*1024, empty string is an error
 func Str2Bytes(size string) (uint64, error) {
 	var base uint64 = 1
 	s := bytes.TrimSpace([]byte(size))
+	if len(s) == 0 {
+		return 0, ErrEmptySize
+	}
 	switch s[len(s)-1] {
 	case 'K', 'k':
 		base *= KBYTE_BASE
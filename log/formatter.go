@@ -0,0 +1,121 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cosiner/gohper/lib/errors"
+	"github.com/cosiner/gohper/lib/types"
+)
+
+// Formatter format log to string for writers
+type Formatter interface {
+	Format(log *Log) string
+}
+
+type (
+	// TextFormatter format log as "[level] time message k=v", fields are
+	// placed before trailing newline of message
+	TextFormatter struct{}
+
+	// JSONFormatter format log as a json object per line, time is formatted
+	// as RFC3339 with nanoseconds, fields are placed after time, level and
+	// msg, fields with these keys are prefixed with "fields.", trailing
+	// newline of message is removed
+	JSONFormatter struct{}
+
+	// LogfmtFormatter format log as a logfmt line like
+	// time=... level=INFO msg="..." k=v, fields are prefixed like
+	// JSONFormatter, trailing newline of message is removed
+	LogfmtFormatter struct{}
+)
+
+// NewFormatter return formatter by name, name is one of text, json, logfmt
+// case insensitively, empty name is text
+func NewFormatter(name string) (Formatter, error) {
+	switch types.TrimLower(name) {
+	case "", "text":
+		return TextFormatter{}, nil
+	case "json":
+		return JSONFormatter{}, nil
+	case "logfmt":
+		return LogfmtFormatter{}, nil
+	}
+	return nil, errors.Errorf("Unknown log format:%s", name)
+}
+
+// Format implements Formatter
+func (TextFormatter) Format(log *Log) string {
+	s := fmt.Sprintf("[%5s] %s %s", log.Level.String(), log.Time, log.Message)
+	if len(log.Fields) == 0 {
+		return s
+	}
+	msg := strings.TrimSuffix(s, "\n")
+	buf := bytes.NewBufferString(msg)
+	for _, f := range log.Fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.String())
+	}
+	if len(msg) < len(s) {
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// Format implements Formatter
+func (JSONFormatter) Format(log *Log) string {
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeJSON(&buf, log.timestamp().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSON(&buf, log.Level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSON(&buf, strings.TrimSuffix(log.Message, "\n"))
+	for _, f := range log.Fields {
+		buf.WriteByte(',')
+		writeJSON(&buf, fieldKey(f.Key))
+		buf.WriteByte(':')
+		writeJSON(&buf, f.Value)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// fieldKey prefix key with "fields." if it's conflict with builtin keys
+func fieldKey(key string) string {
+	switch key {
+	case "time", "level", "msg":
+		return "fields." + key
+	}
+	return key
+}
+
+// writeJSON write value as json, error is written as it's message, value
+// can't be marshaled is written as string by fmt.Sprint
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	if err, is := v.(error); is {
+		v = err.Error()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
+
+// Format implements Formatter
+func (LogfmtFormatter) Format(log *Log) string {
+	var buf bytes.Buffer
+	buf.WriteString(Field{"time", log.timestamp().Format(time.RFC3339Nano)}.String())
+	buf.WriteString(" level=" + log.Level.String() + " ")
+	buf.WriteString(Field{"msg", strings.TrimSuffix(log.Message, "\n")}.String())
+	for _, f := range log.Fields {
+		buf.WriteByte(' ')
+		buf.WriteString(Field{fieldKey(f.Key), f.Value}.String())
+	}
+	buf.WriteByte('\n')
+	return buf.String()
+}
@@ -2,8 +2,10 @@ package log
 
 import (
 	"fmt"
+	"strconv"
+	"time"
 
-	"github.com/cosiner/gohper/lib/time"
+	t "github.com/cosiner/gohper/lib/time"
 
 	"github.com/cosiner/gohper/lib/errors"
 	"github.com/cosiner/gohper/lib/types"
@@ -13,11 +15,20 @@ type (
 	// Level is log level,
 	// DEBUG, INFO, WARN, ERROR, FATAL,
 	Level uint8
-	// Log represend a log with level and log message
+	// Log represend a log with level and log message, Time is Timestamp
+	// formatted as "2006/01/02 15:04:05"
 	Log struct {
-		Level   Level
-		Message string
-		Time    string
+		Level     Level
+		Message   string
+		Time      string
+		Timestamp time.Time
+		Fields    []Field
+	}
+
+	// Field is a key-value pair attached to log
+	Field struct {
+		Key   string
+		Value interface{}
 	}
 )
 
@@ -41,6 +52,7 @@ const (
 	DEF_FLUSHINTERVAL = 30               // flush interval for a flush timer
 	DEF_BUFSIZE       = 1024 * 10        // bufsize for log buffer
 	DEF_BACKLOG       = 100              // channel's back log count
+	DEF_SAMPLE_RATE   = 10               // keep one of every 10 logs when channel is full for POLICY_SAMPLE
 	DEF_FILESIZE      = 1024 * 1024 * 10 // max log file size
 	DEF_LEVEL         = LEVEL_INFO       // default log level
 )
@@ -74,32 +86,113 @@ func ParseLevel(str string) (level Level, err error) {
 	return
 }
 
-// String return a log as string with format "[level] time message"
+// timestamp return Timestamp, if it's zero, parse Time in local time zone
+func (l *Log) timestamp() time.Time {
+	if !l.Timestamp.IsZero() || l.Time == "" {
+		return l.Timestamp
+	}
+	ts, _ := time.ParseInLocation(t.DATETIME_FMT, l.Time, time.Local)
+	return ts
+}
+
+// String return a log as string formatted by TextFormatter
 func (l *Log) String() string {
-	return fmt.Sprintf("[%5s] %s %s", l.Level.String(), l.Time, l.Message)
+	return TextFormatter{}.Format(l)
+}
+
+// Field return value of field with given key, if there are multiple fields
+// with same key, the last is returned
+func (l *Log) Field(key string) (interface{}, bool) {
+	for i := len(l.Fields) - 1; i >= 0; i-- {
+		if l.Fields[i].Key == key {
+			return l.Fields[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// String return field as k=v, value is quoted if it's empty or contains
+// space, quote, = or control characters
+func (f Field) String() string {
+	v := fmt.Sprint(f.Value)
+	if needQuote(v) {
+		v = strconv.Quote(v)
+	}
+	return f.Key + "=" + v
+}
+
+// needQuote check whether value need to be quoted
+func needQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// BADKEY is the key of value which has no key or key is not a string
+const BADKEY = "!BADKEY"
+
+// Fields convert alternating keys and values to fields, if a key is not a
+// string, or the last key has no value, it's value with key BADKEY
+func Fields(keyvals ...interface{}) []Field {
+	fields := make([]Field, 0, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i++ {
+		key, is := keyvals[i].(string)
+		if !is || i+1 == len(keyvals) {
+			fields = append(fields, Field{Key: BADKEY, Value: keyvals[i]})
+			continue
+		}
+		fields = append(fields, Field{Key: key, Value: keyvals[i+1]})
+		i++
+	}
+	return fields
 }
 
 // buildLog format log
 func NewLogf(level Level, format string, v ...interface{}) *Log {
+	now := time.Now()
 	return &Log{
-		Level:   level,
-		Message: fmt.Sprintf(format, v...),
-		Time:    time.DateTime(),
+		Level:     level,
+		Message:   fmt.Sprintf(format, v...),
+		Time:      now.Format(t.DATETIME_FMT),
+		Timestamp: now,
 	}
 }
 
 func NewLog(level Level, v ...interface{}) *Log {
+	now := time.Now()
 	return &Log{
-		Level:   level,
-		Message: fmt.Sprint(v...),
-		Time:    time.DateTime(),
+		Level:     level,
+		Message:   fmt.Sprint(v...),
+		Time:      now.Format(t.DATETIME_FMT),
+		Timestamp: now,
 	}
 }
 
 func NewLogln(level Level, v ...interface{}) *Log {
+	now := time.Now()
+	return &Log{
+		Level:     level,
+		Message:   fmt.Sprintln(v...),
+		Time:      now.Format(t.DATETIME_FMT),
+		Timestamp: now,
+	}
+}
+
+// NewLogw create a log with message and fields, message is terminated by
+// newline like NewLogln
+func NewLogw(level Level, msg string, fields []Field) *Log {
+	now := time.Now()
 	return &Log{
-		Level:   level,
-		Message: fmt.Sprintln(v...),
-		Time:    time.DateTime(),
+		Level:     level,
+		Message:   msg + "\n",
+		Time:      now.Format(t.DATETIME_FMT),
+		Timestamp: now,
+		Fields:    fields,
 	}
 }
@@ -26,16 +26,22 @@ var defTermColor = [5]*termcolor.TermColor{
 // ConsoleLogWriter output log to console
 type ConsoleLogWriter struct {
 	termColor [5]*termcolor.TermColor
+	formatter Formatter
 }
 
 // Config config console log writer
 // parameter conf can use to config color for each log level, such as
-// warn="black"&info="green"&error="red"...
-func (clw *ConsoleLogWriter) Config(conf string) error {
+// warn="black"&info="green"&error="red"..., format=json select formatter,
+// see NewFormatter, color is disabled for formats other than text
+func (clw *ConsoleLogWriter) Config(conf string) (err error) {
 	clw.termColor = defTermColor
+	clw.formatter = TextFormatter{}
 	if conf != "" {
 		c := config.NewConfig(config.LINE)
 		c.ParseString(conf)
+		if clw.formatter, err = NewFormatter(c.ValDef("format", "")); err != nil {
+			return
+		}
 		if _, has := c.Val("disableColor"); has {
 			clw.DisableColor()
 		} else {
@@ -50,6 +56,11 @@ func (clw *ConsoleLogWriter) Config(conf string) error {
 	return nil
 }
 
+// SetFormatter set formatter of console log writer
+func (clw *ConsoleLogWriter) SetFormatter(f Formatter) {
+	clw.formatter = f
+}
+
 // DisableColor disable color output
 func (clw *ConsoleLogWriter) DisableColor() {
 	for _, tc := range clw.termColor {
@@ -63,7 +74,11 @@ func (clw *ConsoleLogWriter) Write(log *Log) error {
 	if log.Level >= LEVEL_ERROR {
 		out = os.Stderr
 	}
-	_, err := fmt.Fprint(out, clw.termColor[log.Level].Render(log.String()))
+	msg := clw.formatter.Format(log)
+	if _, is := clw.formatter.(TextFormatter); is {
+		msg = clw.termColor[log.Level].Render(msg)
+	}
+	_, err := fmt.Fprint(out, msg)
 	return err
 }
 
@@ -2,21 +2,33 @@ package log
 
 import (
 	"bufio"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	t "github.com/cosiner/gohper/lib/time"
 
 	"github.com/cosiner/gohper/config"
 
+	"github.com/cosiner/gohper/lib/errors"
 	"github.com/cosiner/gohper/lib/types"
 )
 
 const (
 	// log dir permission when create
 	_LOGDIR_PERM = 0755
+
+	_ROTATE_DAILY  = "daily"
+	_ROTATE_HOURLY = "hourly"
+	// count of rotated files waiting for compression and cleaning
+	_ROTATED_BACKLOG = 16
 )
 
 var timeFormat = t.FormatLayout("yyyymmdd-HHMMSS")
@@ -28,39 +40,192 @@ var timeFormat = t.FormatLayout("yyyymmdd-HHMMSS")
 type logBuffer struct {
 	file *os.File
 	*bufio.Writer
-	nbytes  uint64
-	logdir  string
-	level   string
-	bufsize uint64
-	maxsize uint64
+	nbytes uint64
+	level  string
+	opts   *fileOptions
+	next   time.Time // time to rotate, zero if not rotate by time
+
+	current atomic.Value  // name of current file
+	rotated chan string   // rotated files to compress and clean in background
+	done    chan struct{} // closed when background worker exit
+}
+
+// fileOptions is options of log files shared by all levels
+type fileOptions struct {
+	logdir   string
+	bufsize  uint64
+	maxsize  uint64
+	rotate   string        // "", daily or hourly
+	maxage   time.Duration // remove rotated files older than it, 0 means no limit
+	maxfiles int           // max files per level of this process include current, 0 means no limit
+	compress bool          // gzip rotated files
 }
 
 // newLogBuffer create a new log buffer
-func newLogBuffer(logdir, level string, bufsize, maxsize uint64) (*logBuffer, error) {
+func newLogBuffer(level string, opts *fileOptions) (*logBuffer, error) {
 	buf := &logBuffer{
-		logdir:  logdir,
 		level:   level,
-		bufsize: bufsize,
-		maxsize: maxsize,
+		opts:    opts,
+		rotated: make(chan string, _ROTATED_BACKLOG),
+		done:    make(chan struct{}),
+	}
+	err := buf.newLogFile()
+	if err == nil {
+		go buf.background()
+	}
+	return buf, err
+}
+
+// background compress rotated files and remove expired files in order
+func (buf *logBuffer) background() {
+	for old := range buf.rotated {
+		if old != "" && buf.opts.compress {
+			compressFile(old)
+		}
+		buf.clean()
 	}
-	return buf, buf.newLogFile()
+	close(buf.done)
 }
 
-// newLogFile create a new log file
+// newLogFile create a new log file, point the current symlink to it, then
+// compress the old file and remove expired files in background
 func (buf *logBuffer) newLogFile() (err error) {
+	var old string
 	if buf.file != nil {
 		buf.Flush()
 		buf.file.Close()
+		old = buf.file.Name()
 	}
-	filename := fmt.Sprintf("%s.log.%s.%d",
-		buf.level, time.Now().Format(timeFormat), os.Getpid())
-	if buf.file, err = os.Create(filepath.Join(buf.logdir, filename)); err == nil {
-		buf.nbytes = 0
-		buf.Writer = bufio.NewWriterSize(buf.file, int(buf.bufsize))
+	now := time.Now()
+	file, err := createLogFile(buf.opts.logdir, fmt.Sprintf("%s.log.%s.%d",
+		buf.level, now.Format(timeFormat), os.Getpid()))
+	if err != nil {
+		return
 	}
+	buf.file, buf.nbytes = file, 0
+	buf.Writer = bufio.NewWriterSize(buf.file, int(buf.opts.bufsize))
+	buf.next = nextRotation(now, buf.opts.rotate)
+	buf.link()
+
+	buf.current.Store(file.Name())
+	buf.rotated <- old
 	return
 }
 
+// createLogFile create a new file, if name is already exist, a sequence
+// number is appended
+func createLogFile(logdir, name string) (*os.File, error) {
+	path := filepath.Join(logdir, name)
+	for i := 1; ; i++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			return file, err
+		}
+		path = filepath.Join(logdir, fmt.Sprintf("%s.%d", name, i))
+	}
+}
+
+// nextRotation return time of next rotation, for daily, it's the start of
+// next day, for hourly, it's the start of next hour
+func nextRotation(now time.Time, rotate string) time.Time {
+	y, m, d := now.Date()
+	switch rotate {
+	case _ROTATE_DAILY:
+		return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	case _ROTATE_HOURLY:
+		return time.Date(y, m, d, now.Hour()+1, 0, 0, 0, now.Location())
+	}
+	return time.Time{}
+}
+
+// link point symlink LEVEL.current to current log file, error is ignored
+func (buf *logBuffer) link() {
+	link := filepath.Join(buf.opts.logdir, buf.level+".current")
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if os.Symlink(filepath.Base(buf.file.Name()), tmp) == nil {
+		if os.Rename(tmp, link) != nil {
+			os.Remove(tmp)
+		}
+	}
+}
+
+// compressFile gzip file to file.gz and remove the original file, modification
+// time is kept for retention
+func compressFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return
+	}
+	dst, err := os.Create(name + ".gz")
+	if err != nil {
+		return
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		os.Chtimes(name+".gz", fi.ModTime(), fi.ModTime())
+		err = os.Remove(name)
+	} else {
+		os.Remove(name + ".gz")
+	}
+	return
+}
+
+// clean remove rotated files older than maxage, then remove oldest files of
+// this process if there are more than maxfiles, current files that linked by
+// *.current are always kept
+func (buf *logBuffer) clean() {
+	if buf.opts.maxage <= 0 && buf.opts.maxfiles <= 0 {
+		return
+	}
+	logdir, prefix := buf.opts.logdir, buf.level+".log."
+	keep := map[string]bool{filepath.Base(buf.current.Load().(string)): true}
+	links, _ := filepath.Glob(filepath.Join(logdir, "*.current"))
+	for _, link := range links {
+		if target, err := os.Readlink(link); err == nil {
+			keep[filepath.Base(target)] = true
+		}
+	}
+	names, _ := filepath.Glob(filepath.Join(logdir, prefix+"*"))
+	pid := strconv.Itoa(os.Getpid())
+	expire := time.Now().Add(-buf.opts.maxage)
+	files := make([]os.FileInfo, 0, len(names))
+	for _, name := range names {
+		fi, err := os.Lstat(name)
+		if err != nil || !fi.Mode().IsRegular() || keep[fi.Name()] {
+			continue
+		}
+		if buf.opts.maxage > 0 && fi.ModTime().Before(expire) {
+			os.Remove(name)
+			continue
+		}
+		// LEVEL.log.<time>.<pid>[.N][.gz]
+		if parts := strings.Split(strings.TrimPrefix(fi.Name(), prefix), "."); len(parts) > 1 && parts[1] == pid {
+			files = append(files, fi)
+		}
+	}
+	if buf.opts.maxfiles <= 0 || len(files) < buf.opts.maxfiles {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, fi := range files[:len(files)-buf.opts.maxfiles+1] {
+		os.Remove(filepath.Join(logdir, fi.Name()))
+	}
+}
+
 // flush flush log buffer
 func (buf *logBuffer) flush() (err error) {
 	if err = buf.Flush(); err == nil {
@@ -69,16 +234,20 @@ func (buf *logBuffer) flush() (err error) {
 	return
 }
 
-// close close the log buffer
+// close close the log buffer, and wait background works done
 func (buf *logBuffer) close() {
 	buf.Flush()
 	buf.file.Close()
+	close(buf.rotated)
+	<-buf.done
 	return
 }
 
-// write write log message to log file
+// write write log message to log file, rotate file if it's time to rotate or
+// size exceed maxsize
 func (buf *logBuffer) write(msg string) (err error) {
-	if buf.nbytes+uint64(len(msg)) >= buf.maxsize {
+	if buf.nbytes+uint64(len(msg)) >= buf.opts.maxsize ||
+		!buf.next.IsZero() && !time.Now().Before(buf.next) {
 		if err = buf.newLogFile(); err != nil {
 			return
 		}
@@ -88,45 +257,99 @@ func (buf *logBuffer) write(msg string) (err error) {
 	return
 }
 
+// parseAge parse age like 7d or duration like 12h
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(s[:len(s)-1])
+		return time.Duration(days) * 24 * time.Hour, err
+	}
+	return time.ParseDuration(s)
+}
+
 //==============================================================================
 //                          File Log Writer
 //==============================================================================
 // logWrite is actuall log writer, output is local file
 type FileLogWriter struct {
-	level Level
-	files []*logBuffer
+	level     Level
+	files     []*logBuffer
+	formatter Formatter
 }
 
-// Config resolv config, format like bufsize=xxx&maxsize=xxx&logdir=xxx&level=info
+// Config resolv config, format like bufsize=xxx&maxsize=xxx&logdir=xxx&level=info&format=json,
+// format is one of text, json, logfmt, see NewFormatter,
+// rotate=daily or rotate=hourly rotate files by time besides maxsize,
+// maxage=7d remove old files of each level include files of previous runs,
+// maxfiles=N keep at most N files of each level written by this process,
+// compress=true gzip rotated files, symlink LEVEL.current in logdir point to
+// current file
 func (writer *FileLogWriter) Config(conf string) (err error) {
 	c := config.NewConfig(config.LINE)
 	if err = c.ParseString(conf); err != nil {
 		return
 	}
+	if writer.formatter, err = NewFormatter(c.ValDef("format", "")); err != nil {
+		return
+	}
 	logdir := c.ValDef("logdir", filepath.Join(os.TempDir(), "gologs"))
 	bufsize, err := types.Str2Bytes(c.ValDef("bufsize", "10K"))
 	maxsize, err := types.Str2Bytes(c.ValDef("maxsize", "10M"))
 	writer.level, err = ParseLevel(c.ValDef("level", "info"))
-	err = os.MkdirAll(logdir, _LOGDIR_PERM)
+	opts := &fileOptions{
+		logdir:  logdir,
+		bufsize: bufsize,
+		maxsize: maxsize,
+	}
+	if err == nil {
+		err = parseFileOptions(c, opts)
+	}
+	if err == nil {
+		err = os.MkdirAll(logdir, _LOGDIR_PERM)
+	}
 
 	writer.files = make([]*logBuffer, _LEVEL_MAX+1)
 	for l := writer.level; l <= _LEVEL_MAX && err == nil; l++ {
-		writer.files[l], err = newLogBuffer(logdir, l.String(), bufsize, maxsize)
+		writer.files[l], err = newLogBuffer(l.String(), opts)
 	}
 	return
 }
 
+// parseFileOptions parse rotate, maxage, maxfiles and compress
+func parseFileOptions(c *config.Config, opts *fileOptions) (err error) {
+	switch opts.rotate = types.TrimLower(c.ValDef("rotate", "")); opts.rotate {
+	case "", _ROTATE_DAILY, _ROTATE_HOURLY:
+	default:
+		return errors.Errorf("Unknown rotation:%s", opts.rotate)
+	}
+	if age := c.ValDef("maxage", ""); age != "" {
+		if opts.maxage, err = parseAge(age); err != nil {
+			return
+		}
+	}
+	if opts.maxfiles = c.IntValDef("maxfiles", 0); opts.maxfiles < 0 {
+		return errors.Errorf("Negative maxfiles:%d", opts.maxfiles)
+	}
+	opts.compress = c.BoolValDef("compress", false)
+	return
+}
+
 // Write write log to log file, higher level log will simultaneously
 // output to all lower level log file
 func (writer *FileLogWriter) Write(log *Log) (err error) {
+	msg := writer.formatter.Format(log)
 	for l := writer.level; l <= log.Level; l++ {
-		if writer.files[l].write(log.String()) != nil {
+		if writer.files[l].write(msg) != nil {
 			return
 		}
 	}
 	return
 }
 
+// SetFormatter set formatter of file log writer
+func (writer *FileLogWriter) SetFormatter(f Formatter) {
+	writer.formatter = f
+}
+
 // Flush flush log writer
 func (writer *FileLogWriter) Flush() {
 	for l := writer.level; l <= _LEVEL_MAX; l++ {
@@ -1,9 +1,19 @@
 package log
 
 import (
-	e "github.com/cosiner/gohper/lib/errors"
-
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	e "github.com/cosiner/gohper/lib/errors"
+	"github.com/cosiner/gohper/lib/test"
 )
 
 func TestConsoleLog(t *testing.T) {
@@ -39,3 +49,328 @@ func TestFileLog(t *testing.T) {
 	logger.Warnln("DDDDDDDDDDDDDDDD")
 	logger.Flush()
 }
+
+// chanWriter send logs to channel
+type chanWriter chan *Log
+
+func (w chanWriter) Config(string) error  { return nil }
+func (w chanWriter) Write(log *Log) error { w <- log; return nil }
+func (w chanWriter) Flush()               {}
+func (w chanWriter) Close()               {}
+
+func TestFields(t *testing.T) {
+	tt := test.Wrap(t)
+	logs := make(chanWriter, 10)
+	logger := New(DEF_FLUSHINTERVAL, LEVEL_INFO)
+	logger.AddWriter(logs)
+	logger.Start()
+
+	reqLogger := logger.With("req_id", 12)
+	reqLogger.Infow("login", "user", "bob smith", "ok")
+	log := <-logs
+	tt.Eq("login\n", log.Message)
+	tt.Eq(3, len(log.Fields))
+	v, has := log.Field("req_id")
+	tt.True(has)
+	tt.Eq(12, v)
+	v, _ = log.Field(BADKEY)
+	tt.Eq("ok", v)
+	tt.True(strings.HasSuffix(log.String(), ` login req_id=12 user="bob smith" !BADKEY=ok`+"\n"))
+
+	reqLogger.With("step", 2).Warnf("retry %d", 3)
+	log = <-logs
+	tt.Eq(2, len(log.Fields))
+	tt.True(strings.HasSuffix(log.String(), " retry 3 req_id=12 step=2"))
+
+	reqLogger.Infoln("done")
+	log = <-logs
+	tt.Eq(1, len(log.Fields))
+	logger.Infow("plain")
+	log = <-logs
+	tt.Eq(0, len(log.Fields))
+
+	dir := t.TempDir()
+	w := new(FileLogWriter)
+	tt.Nil(w.Config("logdir=" + dir + "&level=info"))
+	tt.Nil(w.Write(NewLogw(LEVEL_INFO, "saved", Fields("key", "a=b"))))
+	w.Close()
+	files, _ := filepath.Glob(filepath.Join(dir, "INFO.log.*"))
+	tt.Eq(1, len(files))
+	data, _ := ioutil.ReadFile(files[0])
+	tt.True(strings.HasSuffix(string(data), ` saved key="a=b"`+"\n"))
+}
+
+func TestFormatter(t *testing.T) {
+	tt := test.Wrap(t)
+	log := NewLogw(LEVEL_WARN, `say "hi"`, Fields("user", "bob", "err", e.Err("failed"), "n", 1))
+	log.Time, log.Timestamp = "2015/03/04 05:06:07", time.Date(2015, 3, 4, 5, 6, 7, 89, time.UTC)
+
+	tt.Eq(`[ WARN] 2015/03/04 05:06:07 say "hi" user=bob err=failed n=1`+"\n", log.String())
+	f, err := NewFormatter("JSON")
+	tt.Nil(err)
+	tt.Eq(`{"time":"2015-03-04T05:06:07.000000089Z","level":"WARN","msg":"say \"hi\"","user":"bob","err":"failed","n":1}`+"\n", f.Format(log))
+	f, _ = NewFormatter("logfmt")
+	tt.Eq(`time=2015-03-04T05:06:07.000000089Z level=WARN msg="say \"hi\"" user=bob err=failed n=1`+"\n", f.Format(log))
+	_, err = NewFormatter("xml")
+	tt.NNil(err)
+
+	dup := NewLogw(LEVEL_INFO, "dup", Fields("msg", "m", "level", 1))
+	dup.Timestamp = log.Timestamp
+	tt.Eq(`time=2015-03-04T05:06:07.000000089Z level=INFO msg=dup fields.msg=m fields.level=1`+"\n", f.Format(dup))
+	tt.Eq(`{"time":"2015-03-04T05:06:07.000000089Z","level":"INFO","msg":"dup","fields.msg":"m","fields.level":1}`+"\n", JSONFormatter{}.Format(dup))
+
+	old := &Log{Level: LEVEL_INFO, Message: "old", Time: "2015/03/04 05:06:07"} // Timestamp is not set
+	tt.Eq(`time=`+time.Date(2015, 3, 4, 5, 6, 7, 0, time.Local).Format(time.RFC3339Nano)+" level=INFO msg=old\n", f.Format(old))
+	tt.Eq("[ INFO] 2015/03/04 05:06:07 old", old.String())
+
+	dir := t.TempDir()
+	w := new(FileLogWriter)
+	tt.Nil(w.Config("logdir=" + dir + "&level=warn&format=json"))
+	tt.Nil(w.Write(log))
+	w.Close()
+	files, _ := filepath.Glob(filepath.Join(dir, "WARN.log.*"))
+	tt.Eq(1, len(files))
+	data, _ := ioutil.ReadFile(files[0])
+	tt.True(strings.HasPrefix(string(data), `{"time":"2015-03-04T05:06:07.000000089Z"`))
+	tt.NNil(w.Config("logdir=" + dir + "&format=xml"))
+
+	clw := new(ConsoleLogWriter)
+	tt.Nil(clw.Config("format=logfmt"))
+	tt.Eq(LogfmtFormatter{}, clw.formatter)
+}
+
+// recordWriter record logs, flushes and closes
+type recordWriter struct {
+	sync.Mutex
+	logs    []*Log
+	flushes int
+	closes  int
+	block   chan struct{} // if not nil, Write wait it's closed
+}
+
+func (w *recordWriter) Config(string) error { return nil }
+
+func (w *recordWriter) Write(log *Log) error {
+	if w.block != nil {
+		<-w.block
+	}
+	w.Lock()
+	w.logs = append(w.logs, log)
+	w.Unlock()
+	return nil
+}
+
+func (w *recordWriter) Flush() {
+	w.Lock()
+	w.flushes++
+	w.Unlock()
+}
+
+func (w *recordWriter) Close() {
+	w.Lock()
+	w.closes++
+	w.Unlock()
+}
+
+func TestClose(t *testing.T) {
+	tt := test.Wrap(t)
+	w := new(recordWriter)
+	logger := New(DEF_FLUSHINTERVAL, LEVEL_INFO)
+	logger.AddWriter(w)
+	for i := 0; i < 10; i++ {
+		logger.Infof("%d", i)
+	}
+	tt.Nil(logger.Close(context.Background()))
+	tt.Eq(10, len(w.logs))
+	tt.Eq("9", w.logs[9].Message)
+	tt.Eq(1, w.closes)
+	logger.Info("dropped")
+	logger.Flush()
+	tt.Nil(logger.Close(context.Background()))
+	tt.Eq(10, len(w.logs))
+
+	w = &recordWriter{block: make(chan struct{})}
+	logger = New(DEF_FLUSHINTERVAL, LEVEL_INFO)
+	logger.AddWriter(w)
+	logger.Start()
+	logger.Info("blocked")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	tt.Eq(context.DeadlineExceeded, logger.Close(ctx))
+	close(w.block)
+	tt.Nil(logger.Close(context.Background()))
+	tt.Eq(1, len(w.logs))
+
+	w = new(recordWriter)
+	logger = New(DEF_FLUSHINTERVAL, LEVEL_INFO)
+	logger.AddWriter(w)
+	logger.Start()
+	defer logger.Close(context.Background())
+	func() {
+		defer func() {
+			tt.NNil(recover())
+		}()
+		logger.Infow("before")
+		logger.Fatalw("crash", "code", 1)
+	}()
+	w.Lock()
+	tt.Eq(2, len(w.logs))
+	tt.True(w.flushes > 0)
+	w.Unlock()
+}
+
+func TestPolicy(t *testing.T) {
+	tt := test.Wrap(t)
+	run := func(opts ...Option) []*Log {
+		w := new(recordWriter)
+		logger := New(DEF_FLUSHINTERVAL, LEVEL_INFO, opts...)
+		logger.AddWriter(w)
+		for i := 0; i < 5; i++ {
+			logger.Infof("%d", i)
+		}
+		tt.Nil(logger.Close(context.Background()))
+		return w.logs
+	}
+
+	logs := run(WithBacklog(2), WithPolicy(POLICY_DROP_NEWEST))
+	tt.Eq(3, len(logs))
+	tt.Eq("0", logs[0].Message)
+	tt.Eq("1", logs[1].Message)
+	dropped, _ := logs[2].Field("dropped")
+	tt.Eq(uint64(3), dropped)
+	policy, _ := logs[2].Field("policy")
+	tt.Eq("drop_newest", policy)
+
+	logs = run(WithBacklog(2), WithPolicy(POLICY_DROP_OLDEST))
+	tt.Eq(3, len(logs))
+	tt.Eq("3", logs[0].Message)
+	tt.Eq("4", logs[1].Message)
+
+	logs = run(WithBacklog(1), WithPolicy(POLICY_SAMPLE), WithSampleRate(2))
+	tt.Eq(2, len(logs))
+	tt.Eq("4", logs[0].Message)
+	dropped, _ = logs[1].Field("dropped")
+	tt.Eq(uint64(4), dropped)
+
+	logs = run(WithBacklog(10))
+	tt.Eq(5, len(logs))
+}
+
+func TestRotation(t *testing.T) {
+	tt := test.Wrap(t)
+	dir := t.TempDir()
+	old := filepath.Join(dir, fmt.Sprintf("ERROR.log.20150304-050607.%d", os.Getpid()))
+	prev := filepath.Join(dir, "ERROR.log.20150304-050607.1") // previous run
+	live := filepath.Join(dir, "ERROR.log.20150304-050607.2") // linked by another process
+	recent := filepath.Join(dir, "ERROR.log.20150304-050607.3")
+	past := time.Now().Add(-8 * 24 * time.Hour)
+	for _, f := range []string{old, prev, live, recent} {
+		tt.Nil(ioutil.WriteFile(f, []byte("old"), 0644))
+		if f != recent {
+			tt.Nil(os.Chtimes(f, past, past))
+		}
+	}
+	tt.Nil(os.Symlink(filepath.Base(live), filepath.Join(dir, "OTHER.current")))
+
+	w := new(FileLogWriter)
+	tt.Nil(w.Config("logdir=" + dir + "&level=error&maxsize=100&maxfiles=3&maxage=7d&compress=true&rotate=hourly"))
+	for i := 0; i < 10; i++ {
+		tt.Nil(w.Write(NewLogf(LEVEL_ERROR, "%02d %s\n", i, strings.Repeat("x", 40))))
+	}
+	buf := w.files[LEVEL_ERROR]
+	buf.next = time.Now().Add(-time.Second) // it's time to rotate
+	name := buf.file.Name()
+	tt.Nil(w.Write(NewLogf(LEVEL_ERROR, "%02d\n", 10)))
+	tt.True(name != buf.file.Name())
+	w.Close()
+
+	_, err := os.Stat(old)
+	tt.True(os.IsNotExist(err))
+	_, err = os.Stat(prev)
+	tt.True(os.IsNotExist(err))
+	tt.Nil(os.Remove(live))   // linked files are kept
+	tt.Nil(os.Remove(recent)) // maxfiles only limit files of this process
+	files, _ := filepath.Glob(filepath.Join(dir, "ERROR.log.*"))
+	tt.Eq(3, len(files))
+	link, err := os.Readlink(filepath.Join(dir, "ERROR.current"))
+	tt.Nil(err)
+	tt.Eq(filepath.Base(buf.file.Name()), link)
+	data, _ := ioutil.ReadFile(filepath.Join(dir, link))
+	tt.True(strings.HasSuffix(string(data), " 10\n"))
+
+	var gz int
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".gz") {
+			continue
+		}
+		gz++
+		fd, err := os.Open(f)
+		tt.Nil(err)
+		zr, err := gzip.NewReader(fd)
+		tt.Nil(err)
+		data, _ = ioutil.ReadAll(zr)
+		fd.Close()
+		tt.True(strings.Contains(string(data), "xxxx"))
+	}
+	tt.Eq(2, gz)
+
+	now := time.Date(2015, 3, 4, 23, 6, 7, 0, time.UTC)
+	tt.Eq(time.Date(2015, 3, 5, 0, 0, 0, 0, time.UTC), nextRotation(now, _ROTATE_DAILY))
+	tt.Eq(time.Date(2015, 3, 5, 0, 0, 0, 0, time.UTC), nextRotation(now, _ROTATE_HOURLY))
+	tt.True(nextRotation(now, "").IsZero())
+	age, err := parseAge("7d")
+	tt.Nil(err)
+	tt.Eq(7*24*time.Hour, age)
+	tt.NNil(new(FileLogWriter).Config("logdir=" + dir + "&rotate=weekly"))
+	tt.NNil(new(FileLogWriter).Config("logdir=" + dir + "&maxage=7w"))
+}
+
+func TestCloseBlocked(t *testing.T) {
+	tt := test.Wrap(t)
+	w := &recordWriter{block: make(chan struct{})}
+	logger := New(DEF_FLUSHINTERVAL, LEVEL_INFO, WithBacklog(1))
+	logger.AddWriter(w)
+	logger.Start()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger.Info("blocked")
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	tt.Eq(context.DeadlineExceeded, logger.Close(ctx))
+	tt.True(time.Since(start) < time.Second)
+	wg.Wait() // blocked senders are released
+	logger.Info("dropped")
+
+	close(w.block)
+	tt.Nil(logger.Close(context.Background()))
+	tt.Eq(1, w.closes)
+}
+
+func TestPolicyKeepFatal(t *testing.T) {
+	tt := test.Wrap(t)
+	w := new(recordWriter)
+	logger := New(DEF_FLUSHINTERVAL, LEVEL_INFO, WithBacklog(1), WithPolicy(POLICY_DROP_OLDEST))
+	logger.AddWriter(w)
+	func() {
+		defer func() {
+			tt.NNil(recover())
+		}()
+		logger.Fatal("fatal")
+	}()
+	for i := 0; i < 3; i++ {
+		logger.Info("info")
+	}
+	tt.Nil(logger.Close(context.Background()))
+	tt.Eq(2, len(w.logs))
+	tt.Eq(LEVEL_FATAL, w.logs[0].Level)
+	dropped, _ := w.logs[1].Field("dropped")
+	tt.Eq(uint64(3), dropped)
+}
@@ -1,7 +1,10 @@
 package log
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cosiner/gohper/lib/runtime"
@@ -17,6 +20,9 @@ type (
 		Level() Level
 		SetLevel(Level) error
 		Flush()
+		// Close stop accepting new logs, write all logs in queue, flush and
+		// close all writers, it return when done or ctx is done
+		Close(ctx context.Context) error
 
 		Debugf(string, ...interface{})
 		PosDebugf(int, string, ...interface{})
@@ -36,6 +42,15 @@ type (
 		Warn(...interface{})
 		Error(...interface{})
 		Fatal(...interface{})
+
+		// With return a child logger that attach fields to all logs, keyvals
+		// are alternating keys and values, fields of parent are inherited
+		With(keyvals ...interface{}) Logger
+		Debugw(msg string, keyvals ...interface{})
+		Infow(msg string, keyvals ...interface{})
+		Warnw(msg string, keyvals ...interface{})
+		Errorw(msg string, keyvals ...interface{})
+		Fatalw(msg string, keyvals ...interface{})
 	}
 
 	// Writer is actual log writer
@@ -52,32 +67,124 @@ type (
 
 	// Logger
 	logger struct {
+		*output
+		fields []Field // fields attached to all logs
+	}
+
+	// output is shared by logger and it's children
+	output struct {
 		level         Level
 		writers       []Writer
 		flushInterval time.Duration
 		logs          chan *Log
 		signal        chan byte
+		syncs         chan chan struct{} // sync request, closed when done
+		closing       chan struct{}      // closed when Close is called
+		done          chan struct{}      // closed when all writers are closed
+
+		lock    sync.Mutex // protect started and closed
+		started bool
+		closed  bool
+
+		policy     Policy
+		sampleRate uint64
+		full       uint64 // count of sending when channel is full, for sampling
+		dropped    uint64 // count of dropped logs
+		reported   uint64 // count of dropped logs already reported
 	}
+
+	// Option is option of logger for New
+	Option func(*output)
+
+	// Policy is the policy when log channel is full
+	Policy uint8
+)
+
+const (
+	// POLICY_BLOCK block sending until channel has space
+	POLICY_BLOCK Policy = iota
+	// POLICY_DROP_NEWEST drop the log being sent
+	POLICY_DROP_NEWEST
+	// POLICY_DROP_OLDEST drop the oldest log in channel
+	POLICY_DROP_OLDEST
+	// POLICY_SAMPLE keep one of every sample rate logs by dropping the oldest
+	// log in channel, others are dropped
+	POLICY_SAMPLE
 )
 
+var policyName = [...]string{"block", "drop_newest", "drop_oldest", "sample"}
+
+// String return name of policy
+func (p Policy) String() string {
+	if int(p) < len(policyName) {
+		return policyName[p]
+	}
+	return "unknown"
+}
+
+// WithBacklog set capacity of log channel, default is DEF_BACKLOG
+func WithBacklog(backlog int) Option {
+	return func(o *output) {
+		if backlog > 0 {
+			o.logs = make(chan *Log, backlog)
+		}
+	}
+}
+
+// WithPolicy set policy when log channel is full, default is POLICY_BLOCK,
+// fatal logs are never dropped, count of dropped logs is logged as warning
+// every flush interval and when logger is closed
+func WithPolicy(policy Policy) Option {
+	return func(o *output) {
+		if policy <= POLICY_SAMPLE {
+			o.policy = policy
+		}
+	}
+}
+
+// WithSampleRate set sample rate for POLICY_SAMPLE, default is DEF_SAMPLE_RATE
+func WithSampleRate(rate int) Option {
+	return func(o *output) {
+		if rate > 0 {
+			o.sampleRate = uint64(rate)
+		}
+	}
+}
+
 const (
 	_SIGNAL_FLUSH byte = iota // flush all writer
 )
 
 // NewLogger return a logger, if params is wrong, use default value
-func New(flushInterval int, level Level) Logger {
+func New(flushInterval int, level Level, opts ...Option) Logger {
 	if level < _LEVEL_MIN || level > LEVEL_OFF {
 		level = DEF_LEVEL
 	}
 	if flushInterval <= 0 {
 		flushInterval = DEF_FLUSHINTERVAL
 	}
-	return &logger{
+	o := &output{
 		level:         level,
 		logs:          make(chan *Log, DEF_BACKLOG),
 		signal:        make(chan byte, 1),
+		syncs:         make(chan chan struct{}),
+		closing:       make(chan struct{}),
+		done:          make(chan struct{}),
 		flushInterval: time.Duration(flushInterval) * time.Second,
+		sampleRate:    DEF_SAMPLE_RATE,
+	}
+	for _, opt := range opts {
+		opt(o)
 	}
+	return &logger{output: o}
+}
+
+// With return a child logger share level and writers with parent, the child
+// attach fields of parent and keyvals to all logs
+func (logger *logger) With(keyvals ...interface{}) Logger {
+	child := *logger
+	child.fields = append(logger.fields[:len(logger.fields):len(logger.fields)], Fields(keyvals...)...)
+	return &child
 }
 
 // AddWriter add a  log writer, nil writer will be auto-ignored
@@ -108,38 +215,191 @@ func (logger *logger) SetLevel(level Level) (err error) {
 	return
 }
 
-// Start start logger
+// Start start logger, it's only started once
 func (logger *logger) Start() {
-	go func() {
-		ticker := time.Tick(logger.flushInterval)
+	logger.lock.Lock()
+	if !logger.started && !logger.closed {
+		logger.started = true
+		go logger.run()
+	}
+	logger.lock.Unlock()
+}
+
+// run write logs and flush writers until logger is closing, then write remain
+// logs and close all writers
+func (logger *logger) run() {
+	ticker := time.NewTicker(logger.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case log := <-logger.logs:
+			logger.write(log)
+		case <-logger.closing:
+			logger.drain()
+			logger.reportDropped()
+			for _, writer := range logger.writers {
+				writer.Flush()
+				writer.Close()
+			}
+			close(logger.done)
+			return
+		case <-ticker.C:
+			logger.reportDropped()
+			logger.flush()
+		case <-logger.signal:
+			logger.drain()
+			logger.flush()
+		case c := <-logger.syncs:
+			logger.drain()
+			logger.flush()
+			close(c)
+		}
+	}
+}
+
+// write write log to all writers
+func (logger *logger) write(log *Log) {
+	for _, writer := range logger.writers {
+		writer.Write(log)
+	}
+}
+
+// flush flush all writers
+func (logger *logger) flush() {
+	for _, writer := range logger.writers {
+		writer.Flush()
+	}
+}
+
+// drain write logs already in channel without blocking
+func (logger *logger) drain() {
+	for {
+		select {
+		case log := <-logger.logs:
+			logger.write(log)
+		default:
+			return
+		}
+	}
+}
+
+// reportDropped write a warning log with count of logs dropped since last
+// report
+func (logger *logger) reportDropped() {
+	dropped := atomic.LoadUint64(&logger.dropped)
+	if n := dropped - logger.reported; n > 0 {
+		logger.reported = dropped
+		logger.write(NewLogw(LEVEL_WARN, "log messages dropped",
+			Fields("dropped", n, "policy", logger.policy.String())))
+	}
+}
+
+// send send log to channel by policy, after closing, log is dropped
+func (logger *logger) send(log *Log) {
+	select {
+	case <-logger.closing:
+		return
+	default:
+	}
+	if logger.policy == POLICY_BLOCK || log.Level == LEVEL_FATAL {
+		logger.put(log)
+		return
+	}
+	select {
+	case logger.logs <- log:
+		return
+	default:
+	}
+	switch logger.policy {
+	case POLICY_DROP_NEWEST:
+		atomic.AddUint64(&logger.dropped, 1)
+	case POLICY_SAMPLE:
+		if atomic.AddUint64(&logger.full, 1)%logger.sampleRate != 0 {
+			atomic.AddUint64(&logger.dropped, 1)
+			return
+		}
+		fallthrough
+	case POLICY_DROP_OLDEST:
 		for {
 			select {
-			case log := <-logger.logs:
-				for _, writer := range logger.writers {
-					writer.Write(log)
-				}
-			case <-ticker:
-				for _, writer := range logger.writers {
-					writer.Flush()
-				}
-			case <-logger.signal:
-				for _, writer := range logger.writers {
-					writer.Flush()
+			case logger.logs <- log:
+				return
+			default:
+			}
+			select {
+			case old := <-logger.logs:
+				atomic.AddUint64(&logger.dropped, 1)
+				if old.Level == LEVEL_FATAL { // fatal log is never dropped, drop the new one
+					logger.put(old)
+					return
 				}
+			default:
 			}
 		}
-	}()
+	}
 }
 
-// Flush flush logger
+// put send log to channel, wait until there is space or logger is closing
+func (logger *logger) put(log *Log) {
+	select {
+	case logger.logs <- log:
+	case <-logger.closing:
+	}
+}
+
+// Flush flush logger, logs already sent will be written before flushing
 func (logger *logger) Flush() {
-	logger.signal <- _SIGNAL_FLUSH
+	select {
+	case logger.signal <- _SIGNAL_FLUSH:
+	case <-logger.closing:
+	}
+}
+
+// sync wait until logs already sent are written and writers are flushed, if
+// logger is not started or closed, it return immediately
+func (logger *logger) sync() {
+	logger.lock.Lock()
+	started := logger.started
+	logger.lock.Unlock()
+	if !started {
+		return
+	}
+	c := make(chan struct{})
+	select {
+	case logger.syncs <- c:
+		<-c
+	case <-logger.closing:
+	}
+}
+
+// Close stop accepting new logs, write all logs in queue, flush and close all
+// writers, it return nil when done or error of ctx when ctx is done first,
+// logging goroutines blocked by full queue are released and their logs are
+// dropped, if logger is not started, it's started to write remain logs
+func (logger *logger) Close(ctx context.Context) error {
+	logger.lock.Lock()
+	if !logger.closed {
+		logger.closed = true
+		close(logger.closing)
+		if !logger.started {
+			logger.started = true
+			go logger.run()
+		}
+	}
+	logger.lock.Unlock()
+	select {
+	case <-logger.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (logger *logger) logf(level Level, format string, v ...interface{}) *Log {
 	if level >= logger.level {
 		log := NewLogf(level, format, v...)
-		logger.logs <- log
+		log.Fields = logger.fields
+		logger.send(log)
 		return log
 	}
 	return nil
@@ -148,7 +408,8 @@ func (logger *logger) logf(level Level, format string, v ...interface{}) *Log {
 func (logger *logger) logln(level Level, v ...interface{}) *Log {
 	if level >= logger.level {
 		log := NewLogln(level, v...)
-		logger.logs <- log
+		log.Fields = logger.fields
+		logger.send(log)
 		return log
 	}
 	return nil
@@ -157,7 +418,21 @@ func (logger *logger) logln(level Level, v ...interface{}) *Log {
 func (logger *logger) log(level Level, v ...interface{}) *Log {
 	if level >= logger.level {
 		log := NewLog(level, v...)
-		logger.logs <- log
+		log.Fields = logger.fields
+		logger.send(log)
+		return log
+	}
+	return nil
+}
+
+func (logger *logger) logw(level Level, msg string, keyvals ...interface{}) *Log {
+	if level >= logger.level {
+		fields := logger.fields
+		if len(keyvals) > 0 {
+			fields = append(fields[:len(fields):len(fields)], Fields(keyvals...)...)
+		}
+		log := NewLogw(level, msg, fields)
+		logger.send(log)
 		return log
 	}
 	return nil
@@ -194,7 +469,9 @@ func (logger *logger) Errorf(format string, v ...interface{}) {
 
 // Fatalf log for fatal message
 func (logger *logger) Fatalf(format string, v ...interface{}) {
-	panic(logger.logf(LEVEL_FATAL, format, v...))
+	log := logger.logf(LEVEL_FATAL, format, v...)
+	logger.sync()
+	panic(log)
 }
 
 func (logger *logger) PosDebugln(skip int, v ...interface{}) {
@@ -228,6 +505,7 @@ func (logger *logger) Errorln(v ...interface{}) {
 // Fatalln log for fatal message
 func (logger *logger) Fatalln(v ...interface{}) {
 	if log := logger.logln(LEVEL_FATAL, v...); log != nil {
+		logger.sync()
 		panic(log)
 	}
 }
@@ -264,6 +542,37 @@ func (logger *logger) Error(v ...interface{}) {
 // Fatal log for error message
 func (logger *logger) Fatal(v ...interface{}) {
 	if log := logger.log(LEVEL_FATAL, v...); log != nil {
+		logger.sync()
+		panic(log)
+	}
+}
+
+// Debugw log for debug message with fields
+func (logger *logger) Debugw(msg string, keyvals ...interface{}) {
+	logger.logw(LEVEL_DEBUG, msg, keyvals...)
+}
+
+// Infow log for info message with fields
+func (logger *logger) Infow(msg string, keyvals ...interface{}) {
+	logger.logw(LEVEL_INFO, msg, keyvals...)
+}
+
+// Warnw log for warning message with fields
+func (logger *logger) Warnw(msg string, keyvals ...interface{}) {
+	logger.logw(LEVEL_WARN, msg, keyvals...)
+}
+
+// Errorw log for error message with fields
+func (logger *logger) Errorw(msg string, keyvals ...interface{}) {
+	if log := logger.logw(LEVEL_ERROR, msg, keyvals...); logger.level == LEVEL_DEBUG {
+		panic(log)
+	}
+}
+
+// Fatalw log for fatal message with fields
+func (logger *logger) Fatalw(msg string, keyvals ...interface{}) {
+	if log := logger.logw(LEVEL_FATAL, msg, keyvals...); log != nil {
+		logger.sync()
 		panic(log)
 	}
 }
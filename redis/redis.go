@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"time"
 
 	. "github.com/cosiner/gohper/lib/errors"
@@ -19,6 +20,8 @@ var (
 	ToUint64  = redis.Uint64
 	ToFloat64 = redis.Float64
 	ToBool    = redis.Bool
+	ToStrings = redis.Strings
+	ToValues  = redis.Values
 	ErrNil    = redis.ErrNil
 )
 
@@ -82,6 +85,33 @@ func (rs *RedisStore) Query(cmd string, args ...interface{}) (reply interface{},
 	return
 }
 
+// QueryCtx is same as Query, but if ctx is done before replay is received,
+// ctx.Err() is returned immediately, the connection is returned to pool after
+// the replay is received in background
+func (rs *RedisStore) QueryCtx(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ctx.Done() == nil { // never be canceled
+		return rs.Query(cmd, args...)
+	}
+	type result struct {
+		reply interface{}
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reply, err := rs.Query(cmd, args...)
+		done <- result{reply, err}
+	}()
+	select {
+	case r := <-done:
+		return r.reply, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 // Update execute an operation that without replay
 func (rs *RedisStore) Update(cmd string, args ...interface{}) error {
 	c := rs.connPool.Get()
@@ -166,6 +196,59 @@ func (rs *RedisStore) Decr(key string) error {
 	return rs.Update("DECR", key)
 }
 
+// Publish publish message to channel
+func (rs *RedisStore) Publish(channel string, msg interface{}) error {
+	return rs.Update("PUBLISH", channel, msg)
+}
+
+// Subscribe subscribe channels use a dedicated connection, it return after
+// all subscriptions are confirmed by server, then handler will be called in a
+// background goroutine for each message until returned unsubscribe function
+// is called or connection is broken, returned closed channel is closed after
+// that
+func (rs *RedisStore) Subscribe(handler func(channel string, data []byte),
+	channels ...string) (unsubscribe func(), closed <-chan struct{}, err error) {
+	psc := redis.PubSubConn{Conn: rs.connPool.Get()}
+	args := make([]interface{}, len(channels))
+	for i, c := range channels {
+		args[i] = c
+	}
+	if err = psc.Subscribe(args...); err != nil {
+		psc.Close()
+		return
+	}
+	for confirmed := 0; confirmed < len(channels); {
+		switch r := psc.Receive().(type) {
+		case redis.Subscription:
+			confirmed++
+		case error:
+			psc.Close()
+			return nil, nil, r
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			switch r := psc.Receive().(type) {
+			case redis.Message:
+				handler(r.Channel, r.Data)
+			case redis.Subscription:
+				if r.Count == 0 {
+					psc.Close()
+					return
+				}
+			case error:
+				psc.Close()
+				return
+			}
+		}
+	}()
+	return func() {
+		psc.Unsubscribe()
+	}, done, nil
+}
+
 // Destroy destroy redis store
 func (rs *RedisStore) Destroy() {
 	rs.connPool.Close()